@@ -1,35 +1,51 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
 
 	"github.com/nexlycode/nexly/internal/config"
+	"github.com/nexlycode/nexly/internal/providers"
 	"github.com/nexlycode/nexly/internal/tui"
 	"github.com/spf13/cobra"
 )
 
 var (
-	version   = "1.0.0"
-	provider  string
-	model     string
+	version     = "1.0.0"
+	provider    string
+	model       string
 	temperature float64
-	maxTokens int
+	maxTokens   int
+	topP        float64
+	seed        int
+	stop        []string
+
+	thinkingBudget  int
+	reasoningEffort string
+
+	imagePaths []string
 )
 
-	var rootCmd = &cobra.Command{
+var rootCmd = &cobra.Command{
 	Use:   "nexly",
 	Short: "Nexly - AI Coding Assistant",
 	Long:  `Nexly is a powerful CLI coding assistant that helps you write, edit, and understand code.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		cfg := config.LoadConfig()
-		
+
 		if provider != "" {
+			requireProvider(provider)
 			cfg.Provider = provider
 			config.SaveConfig(&cfg)
 			fmt.Printf("Provider set to: %s\n", provider)
 			return
 		}
-		
+
 		if model != "" {
 			cfg.Model = model
 			config.SaveConfig(&cfg)
@@ -37,10 +53,193 @@ var (
 			return
 		}
 
-		tui.Run(cfg)
+		if err := applyGenerationFlags(cmd, &cfg); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+
+		images, err := loadImages(cfg.Model, imagePaths)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+
+		tui.Run(cfg, images)
+	},
+}
+
+var runCmd = &cobra.Command{
+	Use:   "run [prompt]",
+	Short: "Answer a single prompt and exit",
+	Long: `Send a prompt to the current model and print the reply as it streams. With no
+prompt, or "-", the prompt is read from standard input. The model's thinking
+is printed to standard error. Tools are not available.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := config.LoadConfig()
+
+		// Here --provider and --model apply to this prompt only.
+		if provider != "" {
+			requireProvider(provider)
+			cfg.Provider = provider
+		}
+		if model != "" {
+			cfg.Model = model
+		}
+
+		if err := runPrompt(cmd, cfg, args); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
 	},
 }
 
+// runPrompt answers a single prompt, printing the reply as its events
+// arrive.
+func runPrompt(cmd *cobra.Command, cfg config.Config, args []string) error {
+	if err := applyGenerationFlags(cmd, &cfg); err != nil {
+		return err
+	}
+
+	prompt, err := readPrompt(args)
+	if err != nil {
+		return err
+	}
+	images, err := loadImages(cfg.Model, imagePaths)
+	if err != nil {
+		return err
+	}
+
+	if err := cfg.Budget.Check(0, cfg.SpentToday()); err != nil {
+		if !cfg.Budget.Warns() {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "Warning:", err)
+	}
+
+	p, err := cfg.NewProvider(cfg.Provider, cfg.Model)
+	if err != nil {
+		return err
+	}
+	p.SetGeneration(cfg.Generation())
+
+	user := providers.Message{Role: "user"}
+	for _, img := range images {
+		user.Content = append(user.Content, providers.ImageBlock(img))
+	}
+	user.Content = append(user.Content, providers.TextBlock(prompt))
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	stream := providers.StreamMessage(ctx, p, providers.Request{Messages: []providers.Message{user}})
+	defer stream.Close()
+
+	for stream.Next() {
+		e := stream.Event()
+		switch e.Type {
+		case providers.EventText:
+			fmt.Print(e.Text)
+		case providers.EventThinking:
+			fmt.Fprint(os.Stderr, e.Text)
+		case providers.EventUsage:
+			config.AddSpend(providers.Cost(cfg.Model, e.Usage))
+		case providers.EventStop:
+			fmt.Println()
+			if e.StopReason == providers.StopMaxTokens {
+				fmt.Fprintln(os.Stderr, "The reply was cut off by the max tokens limit.")
+			}
+		case providers.EventError:
+			fmt.Println()
+			return e.Err
+		}
+	}
+	return nil
+}
+
+// readPrompt returns the prompt given as an argument, or read from standard
+// input if there is none or it is "-".
+func readPrompt(args []string) (string, error) {
+	if len(args) == 1 && args[0] != "-" {
+		return args[0], nil
+	}
+
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", err
+	}
+	prompt := strings.TrimSpace(string(data))
+	if prompt == "" {
+		return "", fmt.Errorf("no prompt given")
+	}
+	return prompt, nil
+}
+
+// requireProvider exits with an error if name is neither a built-in nor a
+// custom provider.
+func requireProvider(name string) {
+	if !config.IsProvider(name) {
+		fmt.Fprintf(os.Stderr, "Unknown provider: %s (available: %s)\n", name, strings.Join(config.GetProviders(), ", "))
+		os.Exit(1)
+	}
+}
+
+// loadImages reads the images given with --image, checking that the model
+// accepts them.
+func loadImages(model string, paths []string) ([]providers.Image, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	if err := providers.CheckVision(model); err != nil {
+		return nil, err
+	}
+
+	var images []providers.Image
+	for _, path := range paths {
+		img, err := providers.LoadImage(path)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+// applyGenerationFlags overrides the configured sampling settings with the
+// ones given on the command line, for this session only.
+func applyGenerationFlags(cmd *cobra.Command, cfg *config.Config) error {
+	flags := cmd.Flags()
+	if flags.Changed("temperature") {
+		cfg.Temperature = temperature
+	}
+	if flags.Changed("max-tokens") {
+		cfg.MaxTokens = maxTokens
+	}
+	if flags.Changed("top-p") {
+		cfg.TopP = &topP
+	}
+	if flags.Changed("seed") {
+		cfg.Seed = &seed
+	}
+	if flags.Changed("stop") {
+		cfg.Stop = stop
+	}
+	if flags.Changed("thinking-budget") || flags.Changed("reasoning-effort") {
+		reasoning := cfg.Reasoning[cfg.Model]
+		if flags.Changed("thinking-budget") {
+			reasoning.BudgetTokens = thinkingBudget
+		}
+		if flags.Changed("reasoning-effort") {
+			reasoning.Effort = reasoningEffort
+		}
+		if cfg.Reasoning == nil {
+			cfg.Reasoning = make(map[string]config.Reasoning)
+		}
+		cfg.Reasoning[cfg.Model] = reasoning
+	}
+	return cfg.Generation().Validate(cfg.Provider)
+}
+
 var providerCmd = &cobra.Command{
 	Use:   "provider",
 	Short: "Manage AI providers",
@@ -55,6 +254,7 @@ var providerSetCmd = &cobra.Command{
 	Short: "Set the AI provider",
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
+		requireProvider(args[0])
 		cfg := config.LoadConfig()
 		cfg.Provider = args[0]
 		config.SaveConfig(&cfg)
@@ -68,6 +268,45 @@ var modelCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		cfg := config.LoadConfig()
 		fmt.Printf("Current model: %s\n", cfg.Model)
+		if info, ok := providers.LookupModel(cfg.Model); ok {
+			fmt.Printf("  %s\n", info.Summary())
+		}
+
+		fmt.Printf("\nAvailable models for %s:\n", cfg.Provider)
+		for _, name := range config.GetModels(cfg.Provider) {
+			info, _ := providers.LookupModel(name)
+			fmt.Printf("  %-40s %s\n", name, info.Summary())
+		}
+		if fetched := config.LoadModelCache(); time.Since(fetched) > config.ModelCacheTTL {
+			fmt.Println("\nRun 'nexly models refresh' to fetch the latest models from the providers.")
+		}
+	},
+}
+
+var modelsCmd = &cobra.Command{
+	Use:   "models",
+	Short: "Manage the model list",
+}
+
+var modelsRefreshCmd = &cobra.Command{
+	Use:   "refresh",
+	Short: "Fetch the models each provider serves",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		found, errs, err := config.RefreshModels(ctx)
+		for _, name := range config.GetProviders() {
+			if models, ok := found[name]; ok {
+				fmt.Printf("%s: %d models\n", name, len(models))
+			} else if errs[name] != nil {
+				fmt.Printf("%s: skipped: %v\n", name, errs[name])
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
 	},
 }
 
@@ -92,6 +331,37 @@ var configCmd = &cobra.Command{
 		fmt.Printf("Model: %s\n", cfg.Model)
 		fmt.Printf("Temperature: %f\n", cfg.Temperature)
 		fmt.Printf("MaxTokens: %d\n", cfg.MaxTokens)
+		if cfg.TopP != nil {
+			fmt.Printf("TopP: %f\n", *cfg.TopP)
+		}
+		if len(cfg.Stop) > 0 {
+			fmt.Printf("Stop: %q\n", cfg.Stop)
+		}
+		if cfg.Seed != nil {
+			fmt.Printf("Seed: %d\n", *cfg.Seed)
+		}
+		if r, ok := cfg.Reasoning[cfg.Model]; ok {
+			if r.BudgetTokens > 0 {
+				fmt.Printf("Thinking budget: %d\n", r.BudgetTokens)
+			}
+			if r.Effort != "" {
+				fmt.Printf("Reasoning effort: %s\n", r.Effort)
+			}
+		}
+		fmt.Printf("Spent today: $%.2f\n", cfg.SpentToday())
+		if cfg.Budget.Daily > 0 {
+			fmt.Printf("Daily budget: $%.2f\n", cfg.Budget.Daily)
+		}
+		if cfg.Budget.Session > 0 {
+			fmt.Printf("Session budget: $%.2f\n", cfg.Budget.Session)
+		}
+		if cfg.Budget.Daily > 0 || cfg.Budget.Session > 0 {
+			mode := cfg.Budget.Mode
+			if mode == "" {
+				mode = config.BudgetBlock
+			}
+			fmt.Printf("Budget mode: %s\n", mode)
+		}
 	},
 }
 
@@ -106,20 +376,32 @@ var versionCmd = &cobra.Command{
 func Execute() error {
 	providerCmd.AddCommand(providerSetCmd)
 	modelCmd.AddCommand(modelSetCmd)
-	
+	modelsCmd.AddCommand(modelsRefreshCmd)
+
 	rootCmd.AddCommand(providerCmd)
 	rootCmd.AddCommand(modelCmd)
+	rootCmd.AddCommand(modelsCmd)
 	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(runCmd)
 	rootCmd.AddCommand(versionCmd)
 
 	rootCmd.PersistentFlags().StringVarP(&provider, "provider", "p", "", "Set AI provider")
 	rootCmd.PersistentFlags().StringVarP(&model, "model", "m", "", "Set AI model")
-	rootCmd.PersistentFlags().Float64VarP(&temperature, "temperature", "t", 0.7, "Set temperature")
-	rootCmd.PersistentFlags().IntVarP(&maxTokens, "max-tokens", "M", 4096, "Set max tokens")
+	rootCmd.PersistentFlags().Float64VarP(&temperature, "temperature", "t", 0.7, "Set temperature for this session")
+	rootCmd.PersistentFlags().IntVarP(&maxTokens, "max-tokens", "M", 4096, "Set max tokens for this session")
+	rootCmd.PersistentFlags().Float64Var(&topP, "top-p", 1, "Set top_p for this session")
+	rootCmd.PersistentFlags().IntVar(&seed, "seed", 0, "Set sampling seed for this session")
+	rootCmd.PersistentFlags().StringSliceVar(&stop, "stop", nil, "Set stop sequences for this session")
+	rootCmd.PersistentFlags().IntVar(&thinkingBudget, "thinking-budget", 0, "Set the thinking budget in tokens for this session")
+	rootCmd.Flags().StringSliceVarP(&imagePaths, "image", "i", nil, "Attach an image (PNG, JPEG or WebP) to the first message")
+	runCmd.Flags().StringSliceVarP(&imagePaths, "image", "i", nil, "Attach an image (PNG, JPEG or WebP) to the prompt")
+	rootCmd.PersistentFlags().StringVar(&reasoningEffort, "reasoning-effort", "", "Set reasoning effort (low, medium, high) for this session")
 
 	return rootCmd.Execute()
 }
 
 func init() {
-	cobra.OnInitialize()
+	cobra.OnInitialize(func() {
+		config.LoadModelCache()
+	})
 }
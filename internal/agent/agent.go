@@ -0,0 +1,220 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/nexlycode/nexly/internal/providers"
+)
+
+// DefaultMaxSteps is the number of model calls a single run may make when
+// no limit is configured.
+const DefaultMaxSteps = 25
+
+// DefaultMaxContinuations is how many times a reply cut off by the output
+// limit is continued when no limit is configured.
+const DefaultMaxContinuations = 3
+
+// continuePrompt asks the model to carry on with a reply that was cut off.
+const continuePrompt = "Your previous reply was cut off by the output limit. Continue exactly where it stopped, without repeating anything or adding any preamble."
+
+// ErrStepLimit is returned when the model keeps calling tools after the
+// configured number of steps.
+var ErrStepLimit = errors.New("agent stopped: step limit reached")
+
+// Executor runs a tool call and returns the output to send back to the model.
+// It should stop the tool once ctx is done.
+type Executor func(ctx context.Context, call providers.ToolCall) (string, error)
+
+// Hooks lets the caller observe a run as it progresses. Any of them may be nil.
+type Hooks struct {
+	// OnEvent receives the events of each request to the model: the text,
+	// thinking and tool calls as they stream, then its usage and why the
+	// model stopped.
+	OnEvent      providers.EventHandler
+	OnToolCall   func(call providers.ToolCall)
+	OnToolResult func(call providers.ToolCall, result string, err error)
+	// OnContinue is called before asking the model to continue a reply
+	// that was cut off by the output limit.
+	OnContinue func()
+	// BeforeRequest is called before each request to the model. If it
+	// returns an error the run stops with that error.
+	BeforeRequest func() error
+}
+
+// Agent drives the conversation between the model and the tools: it sends
+// the conversation, runs whatever tools the model asks for, appends the
+// results and asks again until the model answers without calling a tool.
+type Agent struct {
+	provider         providers.Provider
+	tools            []providers.Tool
+	execute          Executor
+	maxSteps         int
+	maxContinuations int
+}
+
+func New(provider providers.Provider, tools []providers.Tool, execute Executor, maxSteps int) *Agent {
+	if maxSteps <= 0 {
+		maxSteps = DefaultMaxSteps
+	}
+	return &Agent{
+		provider:         provider,
+		tools:            tools,
+		execute:          execute,
+		maxSteps:         maxSteps,
+		maxContinuations: DefaultMaxContinuations,
+	}
+}
+
+// SetMaxContinuations sets how many times a reply cut off by the output
+// limit is continued. 0 uses DefaultMaxContinuations and a negative number
+// turns continuing off.
+func (a *Agent) SetMaxContinuations(n int) {
+	switch {
+	case n == 0:
+		a.maxContinuations = DefaultMaxContinuations
+	case n < 0:
+		a.maxContinuations = 0
+	default:
+		a.maxContinuations = n
+	}
+}
+
+// Run continues the conversation and returns the messages it added: the
+// assistant turns and the tool results between them. On error the messages
+// produced so far are returned alongside it; every tool call among them has
+// a result, so they can be kept in the conversation.
+func (a *Agent) Run(ctx context.Context, messages []providers.Message, hooks Hooks) ([]providers.Message, error) {
+	var added []providers.Message
+	conversation := append([]providers.Message{}, messages...)
+
+	for step := 0; step < a.maxSteps; step++ {
+		var partial strings.Builder
+		resp, thinking, err := a.respond(ctx, conversation, hooks, func(e providers.Event) {
+			if e.Type == providers.EventText {
+				partial.WriteString(e.Text)
+			}
+			if hooks.OnEvent != nil {
+				hooks.OnEvent(e)
+			}
+		})
+		if err != nil {
+			// Text streamed before a cancellation is kept, so the
+			// conversation shows what the model had said so far.
+			if ctx.Err() != nil && partial.Len() > 0 {
+				added = append(added, providers.TextMessage("assistant", partial.String()))
+			}
+			return added, err
+		}
+
+		reply := replyMessage(resp, thinking)
+		conversation = append(conversation, reply)
+		added = append(added, reply)
+
+		if len(resp.ToolCalls) == 0 {
+			return added, nil
+		}
+
+		for i, call := range resp.ToolCalls {
+			if err := ctx.Err(); err != nil {
+				// Every call needs a result before the conversation can be
+				// sent again, so the skipped ones are answered as cancelled.
+				for _, skipped := range resp.ToolCalls[i:] {
+					added = append(added, providers.ToolResultMessage(skipped, "Cancelled before it ran."))
+				}
+				return added, err
+			}
+			result := a.runTool(ctx, call, hooks)
+			conversation = append(conversation, result)
+			added = append(added, result)
+		}
+	}
+
+	return added, ErrStepLimit
+}
+
+// respond sends the conversation and returns the model's reply. A reply cut
+// off by the output limit is continued with further requests, up to
+// maxContinuations of them, and the parts are joined into one reply. The
+// thinking of each part is returned as a block of its own, since a
+// signature only vouches for the thinking of the request it came with.
+func (a *Agent) respond(ctx context.Context, conversation []providers.Message, hooks Hooks, onEvent providers.EventHandler) (*providers.Response, []providers.ContentBlock, error) {
+	var reply *providers.Response
+	var thinking []providers.ContentBlock
+	request := conversation
+
+	for continuations := 0; ; continuations++ {
+		if hooks.BeforeRequest != nil {
+			if err := hooks.BeforeRequest(); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		resp, err := a.provider.SendMessage(ctx, providers.Request{
+			Messages: request,
+			Tools:    a.tools,
+		}, onEvent)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if resp.Thinking != "" {
+			thinking = append(thinking, providers.ThinkingBlock(resp.Thinking, resp.ThinkingSignature))
+		}
+		if reply == nil {
+			reply = resp
+		} else {
+			reply.Content += resp.Content
+			reply.ToolCalls = resp.ToolCalls
+			reply.Usage.Add(resp.Usage)
+			reply.StopReason = resp.StopReason
+		}
+
+		// A reply cut off inside a tool call cannot be continued, since
+		// the model would have to repeat the call.
+		if resp.StopReason != providers.StopMaxTokens || len(resp.ToolCalls) > 0 || continuations >= a.maxContinuations {
+			return reply, thinking, nil
+		}
+
+		if hooks.OnContinue != nil {
+			hooks.OnContinue()
+		}
+		request = append(append([]providers.Message{}, conversation...),
+			providers.TextMessage("assistant", reply.Content),
+			providers.TextMessage("user", continuePrompt),
+		)
+	}
+}
+
+func (a *Agent) runTool(ctx context.Context, call providers.ToolCall, hooks Hooks) providers.Message {
+	if hooks.OnToolCall != nil {
+		hooks.OnToolCall(call)
+	}
+
+	output, err := a.execute(ctx, call)
+	if hooks.OnToolResult != nil {
+		hooks.OnToolResult(call, output, err)
+	}
+	if err != nil {
+		output = "Error: " + err.Error()
+	}
+
+	return providers.ToolResultMessage(call, output)
+}
+
+// replyMessage turns the model's response into an assistant message: its
+// thinking blocks, then its text, then its tool calls.
+func replyMessage(resp *providers.Response, thinking []providers.ContentBlock) providers.Message {
+	msg := providers.Message{Role: "assistant"}
+	msg.Content = append(msg.Content, thinking...)
+	if resp.Content != "" {
+		msg.Content = append(msg.Content, providers.TextBlock(resp.Content))
+	}
+	for _, call := range resp.ToolCalls {
+		msg.Content = append(msg.Content, providers.ToolCallBlock(call))
+	}
+	usage := resp.Usage
+	msg.Usage = &usage
+	return msg
+}
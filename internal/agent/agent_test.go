@@ -0,0 +1,199 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/nexlycode/nexly/internal/providers"
+)
+
+// reply is one scripted answer of the fake provider.
+type reply func(ctx context.Context, onEvent providers.EventHandler) (*providers.Response, error)
+
+// fakeProvider answers requests with the scripted replies in turn,
+// repeating the last one, and records the requests.
+type fakeProvider struct {
+	replies  []reply
+	requests []providers.Request
+}
+
+func (p *fakeProvider) Name() string        { return "fake" }
+func (p *fakeProvider) GetModels() []string { return nil }
+
+func (p *fakeProvider) SendMessage(ctx context.Context, req providers.Request, onEvent providers.EventHandler) (*providers.Response, error) {
+	p.requests = append(p.requests, req)
+	next := p.replies[min(len(p.requests), len(p.replies))-1]
+	return next(ctx, onEvent)
+}
+
+// respond returns a reply that streams the response's text and returns it.
+func respond(resp providers.Response) reply {
+	return func(ctx context.Context, onEvent providers.EventHandler) (*providers.Response, error) {
+		if resp.Content != "" {
+			onEvent(providers.Event{Type: providers.EventText, Text: resp.Content})
+		}
+		r := resp
+		return &r, nil
+	}
+}
+
+func toolCall(id string) providers.ToolCall {
+	return providers.ToolCall{ID: id, Name: "read_file", Arguments: `{"path":"main.go"}`}
+}
+
+func echo(ctx context.Context, call providers.ToolCall) (string, error) {
+	return "ran " + call.ID, nil
+}
+
+func TestRunFeedsToolResultsBack(t *testing.T) {
+	p := &fakeProvider{replies: []reply{
+		respond(providers.Response{ToolCalls: []providers.ToolCall{toolCall("call_1")}, StopReason: providers.StopToolUse}),
+		respond(providers.Response{Content: "Done.", StopReason: providers.StopEnd}),
+	}}
+
+	added, err := New(p, nil, echo, 0).Run(context.Background(), []providers.Message{providers.TextMessage("user", "Read main.go")}, Hooks{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 3 || added[1].Role != "tool" || added[2].Text() != "Done." {
+		t.Fatalf("added %+v", added)
+	}
+	second := p.requests[1].Messages
+	if last := second[len(second)-1]; last.Content[0].ToolResult.Content != "ran call_1" {
+		t.Errorf("second request ends with %+v, want the tool result", last)
+	}
+}
+
+func TestRunStopsAtStepLimit(t *testing.T) {
+	p := &fakeProvider{replies: []reply{
+		respond(providers.Response{ToolCalls: []providers.ToolCall{toolCall("call_1")}, StopReason: providers.StopToolUse}),
+	}}
+
+	added, err := New(p, nil, echo, 3).Run(context.Background(), []providers.Message{providers.TextMessage("user", "Loop")}, Hooks{})
+	if !errors.Is(err, ErrStepLimit) {
+		t.Fatalf("got %v, want ErrStepLimit", err)
+	}
+	if len(p.requests) != 3 {
+		t.Errorf("made %d requests, want 3", len(p.requests))
+	}
+	if len(added) != 6 {
+		t.Errorf("added %d messages, want a call and a result for each step", len(added))
+	}
+}
+
+func TestRunAnswersSkippedCallsAsCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := &fakeProvider{replies: []reply{
+		respond(providers.Response{
+			ToolCalls:  []providers.ToolCall{toolCall("call_1"), toolCall("call_2"), toolCall("call_3")},
+			StopReason: providers.StopToolUse,
+		}),
+	}}
+	execute := func(ctx context.Context, call providers.ToolCall) (string, error) {
+		cancel()
+		return "ran " + call.ID, nil
+	}
+
+	added, err := New(p, nil, execute, 0).Run(ctx, []providers.Message{providers.TextMessage("user", "Read")}, Hooks{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	var results []string
+	for _, m := range added[1:] {
+		r := m.Content[0].ToolResult
+		results = append(results, fmt.Sprintf("%s: %s", r.CallID, r.Content))
+	}
+	want := []string{"call_1: ran call_1", "call_2: Cancelled before it ran.", "call_3: Cancelled before it ran."}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("results = %q, want %q", results, want)
+	}
+}
+
+func TestRunKeepsPartialTextAfterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := &fakeProvider{replies: []reply{
+		func(ctx context.Context, onEvent providers.EventHandler) (*providers.Response, error) {
+			onEvent(providers.Event{Type: providers.EventText, Text: "Hel"})
+			onEvent(providers.Event{Type: providers.EventText, Text: "lo"})
+			cancel()
+			return nil, ctx.Err()
+		},
+	}}
+
+	added, err := New(p, nil, echo, 0).Run(ctx, []providers.Message{providers.TextMessage("user", "Hi")}, Hooks{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if len(added) != 1 || added[0].Role != "assistant" || added[0].Text() != "Hello" {
+		t.Errorf("added %+v, want the partial reply", added)
+	}
+}
+
+func TestRunJoinsContinuedParts(t *testing.T) {
+	p := &fakeProvider{replies: []reply{
+		respond(providers.Response{
+			Content: "Part one, ", Thinking: "first thoughts", ThinkingSignature: "sig-1",
+			Usage: providers.Usage{InputTokens: 100, OutputTokens: 50}, StopReason: providers.StopMaxTokens,
+		}),
+		respond(providers.Response{
+			Content: "part two.", Thinking: "second thoughts", ThinkingSignature: "sig-2",
+			Usage: providers.Usage{InputTokens: 160, OutputTokens: 20}, StopReason: providers.StopEnd,
+		}),
+	}}
+	continued := 0
+
+	added, err := New(p, nil, echo, 0).Run(context.Background(), []providers.Message{providers.TextMessage("user", "Write")}, Hooks{
+		OnContinue: func() { continued++ },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if continued != 1 || len(p.requests) != 2 {
+		t.Fatalf("continued %d times in %d requests, want once in 2", continued, len(p.requests))
+	}
+
+	second := p.requests[1].Messages
+	if n := len(second); second[n-2].Text() != "Part one, " || second[n-1].Text() != continuePrompt {
+		t.Errorf("continuation request ends with %+v", second[n-2:])
+	}
+
+	if len(added) != 1 {
+		t.Fatalf("added %d messages, want one joined reply", len(added))
+	}
+	msg := added[0]
+	want := []providers.ContentBlock{
+		providers.ThinkingBlock("first thoughts", "sig-1"),
+		providers.ThinkingBlock("second thoughts", "sig-2"),
+		providers.TextBlock("Part one, part two."),
+	}
+	if !reflect.DeepEqual(msg.Content, want) {
+		t.Errorf("content = %+v, want %+v", msg.Content, want)
+	}
+	if msg.Usage.InputTokens != 260 || msg.Usage.OutputTokens != 70 {
+		t.Errorf("usage = %+v, want both parts summed", *msg.Usage)
+	}
+}
+
+func TestRunStopsContinuingAtLimit(t *testing.T) {
+	p := &fakeProvider{replies: []reply{
+		respond(providers.Response{Content: "more ", StopReason: providers.StopMaxTokens}),
+	}}
+	a := New(p, nil, echo, 0)
+	a.SetMaxContinuations(2)
+
+	added, err := a.Run(context.Background(), []providers.Message{providers.TextMessage("user", "Write")}, Hooks{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.requests) != 3 {
+		t.Errorf("made %d requests, want the first and 2 continuations", len(p.requests))
+	}
+	if got := added[0].Text(); got != "more more more " {
+		t.Errorf("reply = %q", got)
+	}
+}
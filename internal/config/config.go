@@ -2,31 +2,143 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/nexlycode/nexly/internal/permissions"
+	"github.com/nexlycode/nexly/internal/providers"
 )
 
 type Config struct {
-	Provider    string            `json:"provider"`
-	Model       string            `json:"model"`
-	Temperature float64          `json:"temperature"`
-	MaxTokens   int               `json:"max_tokens"`
-	APIKeys     map[string]string `json:"api_keys"`
-	History     []Message         `json:"history"`
+	Provider         string                     `json:"provider"`
+	Model            string                     `json:"model"`
+	Temperature      float64                    `json:"temperature"`
+	MaxTokens        int                        `json:"max_tokens"`
+	TopP             *float64                   `json:"top_p,omitempty"`
+	Stop             []string                   `json:"stop,omitempty"`
+	Seed             *int                       `json:"seed,omitempty"`
+	Reasoning        map[string]Reasoning       `json:"reasoning,omitempty"`
+	SafetySettings   map[string]string          `json:"safety_settings,omitempty"`
+	APIKeys          map[string]string          `json:"api_keys"`
+	CustomProviders  map[string]CustomProvider  `json:"custom_providers,omitempty"`
+	ProviderSettings map[string]json.RawMessage `json:"provider_settings,omitempty"`
+	MaxSteps         int                        `json:"max_steps"`
+	MaxContinuations int                        `json:"max_continuations"`
+	Permissions      []permissions.Rule         `json:"permissions"`
+	Budget           Budget                     `json:"budget"`
+	Spend            Spend                      `json:"spend"`
+	History          []providers.Message        `json:"history"`
+}
+
+// Reasoning sets how much a model thinks before it answers. Anthropic,
+// Gemini and OpenRouter take a budget in tokens; OpenAI reasoning models and
+// OpenRouter take an effort of "low", "medium" or "high".
+type Reasoning struct {
+	BudgetTokens int    `json:"budget_tokens,omitempty"`
+	Effort       string `json:"effort,omitempty"`
+}
+
+// CustomProvider is a user-defined OpenAI-compatible endpoint, such as a
+// local Ollama, LM Studio, vLLM or llama.cpp server.
+type CustomProvider struct {
+	BaseURL string            `json:"base_url"`
+	APIKey  string            `json:"api_key,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Models  []string          `json:"models,omitempty"`
+}
+
+// Budget caps spending in US dollars. A cap of 0 means no cap.
+type Budget struct {
+	Daily   float64 `json:"daily,omitempty"`
+	Session float64 `json:"session,omitempty"`
+	// Mode is BudgetBlock (the default) to stop sending requests once a
+	// cap is reached, or BudgetWarn to keep sending them with a warning.
+	Mode string `json:"mode,omitempty"`
+}
+
+const (
+	BudgetBlock = "block"
+	BudgetWarn  = "warn"
+)
+
+// ErrBudgetExceeded is returned when a spending cap has been reached.
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// Check returns an error wrapping ErrBudgetExceeded if either cap has been
+// reached by the amounts spent so far.
+func (b Budget) Check(session, today float64) error {
+	if b.Session > 0 && session >= b.Session {
+		return fmt.Errorf("%w: spent $%.2f of the $%.2f session budget", ErrBudgetExceeded, session, b.Session)
+	}
+	if b.Daily > 0 && today >= b.Daily {
+		return fmt.Errorf("%w: spent $%.2f of the $%.2f daily budget", ErrBudgetExceeded, today, b.Daily)
+	}
+	return nil
+}
+
+// Warns reports whether requests are still sent once a cap is reached.
+func (b Budget) Warns() bool {
+	return b.Mode == BudgetWarn
 }
 
-type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+// Spend is the amount spent on the given day, in US dollars.
+type Spend struct {
+	Date   string  `json:"date"`
+	Amount float64 `json:"amount"`
+}
+
+func today() string {
+	return time.Now().Format("2006-01-02")
+}
+
+// SpentToday returns the amount spent since midnight, local time.
+func (c Config) SpentToday() float64 {
+	if c.Spend.Date != today() {
+		return 0
+	}
+	return c.Spend.Amount
+}
+
+// AddSpend adds amount to what was spent today.
+func AddSpend(amount float64) error {
+	if amount <= 0 {
+		return nil
+	}
+	cfg := LoadConfig()
+	cfg.Spend = Spend{Date: today(), Amount: cfg.SpentToday() + amount}
+	return SaveConfig(&cfg)
 }
 
 var defaultConfig = Config{
-	Provider:    "openai",
-	Model:       "gpt-4",
-	Temperature: 0.7,
-	MaxTokens:   4096,
-	APIKeys:     make(map[string]string),
-	History:     []Message{},
+	Provider:         "openai",
+	Model:            "gpt-4",
+	Temperature:      0.7,
+	MaxTokens:        4096,
+	APIKeys:          make(map[string]string),
+	MaxSteps:         25,
+	MaxContinuations: 3,
+	History:          []providers.Message{},
+}
+
+// Generation returns the settings to send with each request, including the
+// reasoning settings of the configured model.
+func (c Config) Generation() providers.GenerationConfig {
+	temperature := c.Temperature
+	reasoning := c.Reasoning[c.Model]
+	return providers.GenerationConfig{
+		Temperature:     &temperature,
+		MaxTokens:       c.MaxTokens,
+		TopP:            c.TopP,
+		Stop:            c.Stop,
+		Seed:            c.Seed,
+		ThinkingBudget:  reasoning.BudgetTokens,
+		ReasoningEffort: reasoning.Effort,
+		SafetySettings:  c.SafetySettings,
+	}
 }
 
 func configPath() string {
@@ -50,7 +162,7 @@ func LoadConfig() Config {
 	if err != nil {
 		cfg := defaultConfig
 		cfg.APIKeys = make(map[string]string)
-		cfg.History = []Message{}
+		cfg.History = []providers.Message{}
 		return cfg
 	}
 
@@ -63,8 +175,9 @@ func LoadConfig() Config {
 		cfg.APIKeys = make(map[string]string)
 	}
 	if cfg.History == nil {
-		cfg.History = []Message{}
+		cfg.History = []providers.Message{}
 	}
+	loadImages(cfg.History)
 
 	return cfg
 }
@@ -74,7 +187,15 @@ func SaveConfig(cfg *Config) error {
 		return err
 	}
 
-	data, err := json.MarshalIndent(cfg, "", "  ")
+	// Images are saved apart from the config, which keeps their digests.
+	saved := *cfg
+	history, err := storeImages(cfg.History)
+	if err != nil {
+		return err
+	}
+	saved.History = history
+
+	data, err := json.MarshalIndent(saved, "", "  ")
 	if err != nil {
 		return err
 	}
@@ -84,81 +205,97 @@ func SaveConfig(cfg *Config) error {
 
 func GetAPIKey(provider string) string {
 	cfg := LoadConfig()
+	if custom, ok := cfg.CustomProviders[provider]; ok && custom.APIKey != "" {
+		return custom.APIKey
+	}
 	return cfg.APIKeys[provider]
 }
 
+// NewProvider creates the named provider, built-in or custom, for the model.
+func (c Config) NewProvider(name, model string) (*providers.SimpleProvider, error) {
+	if custom, ok := c.CustomProviders[name]; ok {
+		apiKey := custom.APIKey
+		if apiKey == "" {
+			apiKey = c.APIKeys[name]
+		}
+		adapter := providers.NewOpenAICompatibleAdapter(name, custom.BaseURL, custom.Headers, custom.Models)
+		return providers.NewSimpleProvider(adapter, apiKey, model), nil
+	}
+
+	adapter, err := providers.Configure(name, c.ProviderSettings[name])
+	if err != nil {
+		return nil, err
+	}
+	if adapter.RequiresKey() && c.APIKeys[name] == "" {
+		return nil, fmt.Errorf("%w for provider: %s", providers.ErrNoAPIKey, name)
+	}
+	return providers.NewSimpleProvider(adapter, c.APIKeys[name], model), nil
+}
+
 func SetAPIKey(provider, key string) error {
 	cfg := LoadConfig()
 	cfg.APIKeys[provider] = key
 	return SaveConfig(&cfg)
 }
 
-func AddMessage(role, content string) error {
+// AddPermissionRule stores a rule ahead of the existing ones, so it takes
+// precedence over them.
+func AddPermissionRule(rule permissions.Rule) error {
+	cfg := LoadConfig()
+	cfg.Permissions = append([]permissions.Rule{rule}, cfg.Permissions...)
+	return SaveConfig(&cfg)
+}
+
+// AddMessages stores messages in the session history, content blocks and
+// all, keeping the last 100.
+func AddMessages(msgs ...providers.Message) error {
 	cfg := LoadConfig()
-	cfg.History = append(cfg.History, Message{
-		Role:    role,
-		Content: content,
-	})
-	
+	cfg.History = append(cfg.History, msgs...)
+
 	if len(cfg.History) > 100 {
 		cfg.History = cfg.History[len(cfg.History)-100:]
 	}
-	
+
 	return SaveConfig(&cfg)
 }
 
 func ClearHistory() error {
 	cfg := LoadConfig()
-	cfg.History = []Message{}
+	cfg.History = []providers.Message{}
 	return SaveConfig(&cfg)
 }
 
 func GetModels(provider string) []string {
-	switch provider {
-	case "openai":
-		return []string{
-			"gpt-4-turbo",
-			"gpt-4",
-			"gpt-4o",
-			"gpt-4o-mini",
-			"gpt-3.5-turbo",
-			"o1",
-			"o1-mini",
-			"o1-preview",
-		}
-	case "anthropic":
-		return []string{
-			"claude-3-5-sonnet-20241022",
-			"claude-3-5-sonnet-20240620",
-			"claude-3-opus-20240229",
-			"claude-3-haiku-20240307",
-		}
-	case "google":
-		return []string{
-			"gemini-2.0-flash",
-			"gemini-1.5-pro",
-			"gemini-1.5-flash",
-			"gemini-1.0-pro",
-		}
-	case "openrouter":
-		return []string{
-			"openai/gpt-4",
-			"openai/gpt-4o",
-			"anthropic/claude-3.5-sonnet",
-			"google/gemini-pro-1.5",
-			"meta-llama/llama-3.1-70b-instruct",
-		}
-	case "nvidia":
-		return []string{
-			"nvidia/llama-3.1-nemotron-70b-instruct",
-			"nvidia/mixtral-8x7b-instruct-v0.1",
-			"nvidia/mistral-7b-instruct-v0.2",
-		}
-	default:
-		return []string{"gpt-4"}
+	cfg := LoadConfig()
+	if custom, ok := cfg.CustomProviders[provider]; ok {
+		return providers.NewOpenAICompatibleAdapter(provider, custom.BaseURL, custom.Headers, custom.Models).Models()
+	}
+	if adapter, err := providers.Configure(provider, cfg.ProviderSettings[provider]); err == nil {
+		return adapter.Models()
 	}
+	if adapter, ok := providers.Lookup(provider); ok {
+		return adapter.Models()
+	}
+	return nil
 }
 
+// GetProviders lists the built-in providers followed by the custom ones.
 func GetProviders() []string {
-	return []string{"openai", "anthropic", "google", "openrouter", "nvidia"}
+	var custom []string
+	for name := range LoadConfig().CustomProviders {
+		custom = append(custom, name)
+	}
+	sort.Strings(custom)
+
+	return append(providers.Names(), custom...)
+}
+
+// IsProvider reports whether name is a built-in or custom provider.
+func IsProvider(name string) bool {
+	for _, p := range GetProviders() {
+		if p == name {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nexlycode/nexly/internal/providers"
+)
+
+// Images attached to the history are kept out of the config, which is
+// rewritten after every reply. Each is stored once under ~/.nexly/images,
+// named by the SHA-256 digest of its data, and the history refers to it by
+// that digest.
+
+func imagesDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".nexly", "images")
+}
+
+// storeImages writes the images of the history to the image store and
+// returns a copy of the history that refers to them by digest. Stored
+// images the history no longer refers to are removed.
+func storeImages(history []providers.Message) ([]providers.Message, error) {
+	stored := make([]providers.Message, len(history))
+	keep := make(map[string]bool)
+	for i, m := range history {
+		content := make([]providers.ContentBlock, len(m.Content))
+		for j, b := range m.Content {
+			if b.Type == providers.BlockImage && b.Image != nil {
+				img := *b.Image
+				if img.Data != nil {
+					sum := sha256.Sum256(img.Data)
+					img.SHA256 = hex.EncodeToString(sum[:])
+					if err := writeImage(img.SHA256, img.Data); err != nil {
+						return nil, err
+					}
+					img.Data = nil
+				}
+				keep[img.SHA256] = true
+				b.Image = &img
+			}
+			content[j] = b
+		}
+		m.Content = content
+		stored[i] = m
+	}
+
+	entries, _ := os.ReadDir(imagesDir())
+	for _, e := range entries {
+		if !keep[e.Name()] {
+			os.Remove(filepath.Join(imagesDir(), e.Name()))
+		}
+	}
+	return stored, nil
+}
+
+func writeImage(digest string, data []byte) error {
+	path := filepath.Join(imagesDir(), digest)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(imagesDir(), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("storing image: %w", err)
+	}
+	return nil
+}
+
+// loadImages reads the data of the history's images back from the image
+// store. An image that is missing from the store, or no longer matches its
+// digest, is replaced with a note saying so, since it cannot be sent.
+func loadImages(history []providers.Message) {
+	for _, m := range history {
+		for j, b := range m.Content {
+			if b.Type != providers.BlockImage || b.Image == nil || b.Image.Data != nil || b.Image.SHA256 == "" {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(imagesDir(), b.Image.SHA256))
+			sum := sha256.Sum256(data)
+			if err != nil || hex.EncodeToString(sum[:]) != b.Image.SHA256 {
+				m.Content[j] = providers.TextBlock(fmt.Sprintf("[image %s is no longer available]", b.Image.Name))
+				continue
+			}
+			b.Image.Data = data
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nexlycode/nexly/internal/providers"
+)
+
+// ModelCacheTTL is how long the models found by RefreshModels are used
+// before they have to be refreshed again.
+const ModelCacheTTL = 24 * time.Hour
+
+type modelCache struct {
+	Providers map[string]cachedModels `json:"providers"`
+}
+
+// cachedModels are the models found for one provider. Each provider keeps
+// the time of its own last successful refresh, so models kept after a
+// failed one still expire.
+type cachedModels struct {
+	FetchedAt time.Time             `json:"fetched_at"`
+	Models    []providers.ModelInfo `json:"models"`
+}
+
+func modelCachePath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".nexly", "models.json")
+}
+
+// LoadModelCache makes the models found by the last refreshes available to
+// the providers, except those fetched longer than ModelCacheTTL ago. It
+// returns when the oldest of them were fetched, or the zero time if there
+// are none.
+func LoadModelCache() time.Time {
+	cache, ok := readModelCache()
+	if !ok {
+		return time.Time{}
+	}
+
+	var oldest time.Time
+	for name, cached := range cache.Providers {
+		if oldest.IsZero() || cached.FetchedAt.Before(oldest) {
+			oldest = cached.FetchedAt
+		}
+		if time.Since(cached.FetchedAt) <= ModelCacheTTL {
+			providers.SetDiscoveredModels(name, cached.Models)
+		}
+	}
+	return oldest
+}
+
+func readModelCache() (modelCache, bool) {
+	data, err := os.ReadFile(modelCachePath())
+	if err != nil {
+		return modelCache{}, false
+	}
+	var cache modelCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return modelCache{}, false
+	}
+	return cache, true
+}
+
+// RefreshModels asks every provider with an API key, and every custom
+// provider, which models it serves, and caches the answers. The result maps
+// each provider to the models found, and errs maps the ones that could not
+// be asked to the reason; the models cached for those before are kept. err
+// is set if the cache could not be written.
+func RefreshModels(ctx context.Context) (result map[string][]providers.ModelInfo, errs map[string]error, err error) {
+	cfg := LoadConfig()
+	result = make(map[string][]providers.ModelInfo)
+	errs = make(map[string]error)
+
+	for _, name := range GetProviders() {
+		provider, err := cfg.NewProvider(name, "")
+		if err != nil {
+			errs[name] = err
+			continue
+		}
+		models, err := provider.ListModels(ctx)
+		if err != nil {
+			errs[name] = err
+			continue
+		}
+		result[name] = models
+		providers.SetDiscoveredModels(name, models)
+	}
+
+	if len(result) == 0 {
+		return result, errs, nil
+	}
+
+	if err := ensureConfigDir(); err != nil {
+		return result, errs, err
+	}
+	cache := modelCache{Providers: make(map[string]cachedModels)}
+	if old, ok := readModelCache(); ok {
+		for name, cached := range old.Providers {
+			if _, failed := errs[name]; failed {
+				cache.Providers[name] = cached
+			}
+		}
+	}
+	now := time.Now()
+	for name, models := range result {
+		cache.Providers[name] = cachedModels{FetchedAt: now, Models: models}
+	}
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return result, errs, err
+	}
+	if err := os.WriteFile(modelCachePath(), data, 0600); err != nil {
+		return result, errs, fmt.Errorf("writing model cache: %w", err)
+	}
+	return result, errs, nil
+}
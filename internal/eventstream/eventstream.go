@@ -0,0 +1,167 @@
+package eventstream
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"time"
+)
+
+// maxMessageSize is the largest message the format allows.
+const maxMessageSize = 16 << 20
+
+// preludeSize is the size of the total length, headers length and prelude
+// checksum that start every message.
+const preludeSize = 12
+
+// Message is one message of an AWS event stream. Header values are given as
+// strings whatever their type: numbers in decimal, timestamps in RFC 3339,
+// byte arrays in base64 and UUIDs in hex.
+type Message struct {
+	Headers map[string]string
+	Payload []byte
+}
+
+// Decoder reads the binary event stream framing AWS uses for streaming
+// responses: each message is a prelude with its lengths, typed headers and
+// a payload, with CRC32 checksums over the prelude and the whole message.
+type Decoder struct {
+	r io.Reader
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// Next returns the next message. It returns io.EOF once the stream has
+// ended between messages, and io.ErrUnexpectedEOF if it ends inside one.
+func (d *Decoder) Next() (Message, error) {
+	prelude := make([]byte, preludeSize)
+	if _, err := io.ReadFull(d.r, prelude); err != nil {
+		return Message{}, err
+	}
+
+	total := binary.BigEndian.Uint32(prelude[0:4])
+	headersLen := binary.BigEndian.Uint32(prelude[4:8])
+	if crc32.ChecksumIEEE(prelude[:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+		return Message{}, errors.New("event stream: prelude checksum mismatch")
+	}
+	if total > maxMessageSize || total < preludeSize+4 || headersLen > total-preludeSize-4 {
+		return Message{}, fmt.Errorf("event stream: invalid message length %d", total)
+	}
+
+	message := make([]byte, total)
+	copy(message, prelude)
+	if _, err := io.ReadFull(d.r, message[preludeSize:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Message{}, err
+	}
+
+	end := total - 4
+	if crc32.ChecksumIEEE(message[:end]) != binary.BigEndian.Uint32(message[end:]) {
+		return Message{}, errors.New("event stream: message checksum mismatch")
+	}
+
+	headers, err := decodeHeaders(message[preludeSize : preludeSize+headersLen])
+	if err != nil {
+		return Message{}, err
+	}
+	return Message{Headers: headers, Payload: message[preludeSize+headersLen : end]}, nil
+}
+
+// The types of header value.
+const (
+	typeTrue = iota
+	typeFalse
+	typeByte
+	typeShort
+	typeInt
+	typeLong
+	typeBytes
+	typeString
+	typeTimestamp
+	typeUUID
+)
+
+func decodeHeaders(b []byte) (map[string]string, error) {
+	errShort := errors.New("event stream: truncated header")
+	headers := make(map[string]string)
+
+	for len(b) > 0 {
+		nameLen := int(b[0])
+		if len(b) < 1+nameLen+1 {
+			return nil, errShort
+		}
+		name := string(b[1 : 1+nameLen])
+		valueType := b[1+nameLen]
+		b = b[1+nameLen+1:]
+
+		// size is the length of the value for the fixed-size types.
+		size := 0
+		switch valueType {
+		case typeTrue:
+			headers[name] = "true"
+			continue
+		case typeFalse:
+			headers[name] = "false"
+			continue
+		case typeByte:
+			size = 1
+		case typeShort:
+			size = 2
+		case typeInt:
+			size = 4
+		case typeLong, typeTimestamp:
+			size = 8
+		case typeUUID:
+			size = 16
+		case typeBytes, typeString:
+			if len(b) < 2 {
+				return nil, errShort
+			}
+			n := int(binary.BigEndian.Uint16(b))
+			if len(b) < 2+n {
+				return nil, errShort
+			}
+			value := b[2 : 2+n]
+			if valueType == typeString {
+				headers[name] = string(value)
+			} else {
+				headers[name] = base64.StdEncoding.EncodeToString(value)
+			}
+			b = b[2+n:]
+			continue
+		default:
+			return nil, fmt.Errorf("event stream: unknown header type %d", valueType)
+		}
+
+		if len(b) < size {
+			return nil, errShort
+		}
+		value := b[:size]
+		switch valueType {
+		case typeByte:
+			headers[name] = strconv.Itoa(int(int8(value[0])))
+		case typeShort:
+			headers[name] = strconv.Itoa(int(int16(binary.BigEndian.Uint16(value))))
+		case typeInt:
+			headers[name] = strconv.Itoa(int(int32(binary.BigEndian.Uint32(value))))
+		case typeLong:
+			headers[name] = strconv.FormatInt(int64(binary.BigEndian.Uint64(value)), 10)
+		case typeTimestamp:
+			ms := int64(binary.BigEndian.Uint64(value))
+			headers[name] = time.UnixMilli(ms).UTC().Format(time.RFC3339Nano)
+		case typeUUID:
+			headers[name] = hex.EncodeToString(value)
+		}
+		b = b[size:]
+	}
+	return headers, nil
+}
@@ -0,0 +1,155 @@
+package eventstream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// frame wraps encoded headers and a payload in a prelude and checksums.
+func frame(headers, payload []byte) []byte {
+	total := preludeSize + len(headers) + len(payload) + 4
+	msg := make([]byte, preludeSize, total)
+	binary.BigEndian.PutUint32(msg[0:4], uint32(total))
+	binary.BigEndian.PutUint32(msg[4:8], uint32(len(headers)))
+	binary.BigEndian.PutUint32(msg[8:12], crc32.ChecksumIEEE(msg[:8]))
+	msg = append(msg, headers...)
+	msg = append(msg, payload...)
+	return binary.BigEndian.AppendUint32(msg, crc32.ChecksumIEEE(msg))
+}
+
+// header encodes one header with a value already encoded for its type.
+func header(name string, valueType byte, value []byte) []byte {
+	b := append([]byte{byte(len(name))}, name...)
+	return append(append(b, valueType), value...)
+}
+
+// TestRecordedStream decodes a ConverseStream reply that reads a file
+// with a tool call.
+func TestRecordedStream(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "converse-stream.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var types []string
+	var payloads []string
+	d := NewDecoder(bytes.NewReader(data))
+	for {
+		msg, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		if msg.Headers[":message-type"] != "event" || msg.Headers[":content-type"] != "application/json" {
+			t.Errorf("unexpected headers %v", msg.Headers)
+		}
+		types = append(types, msg.Headers[":event-type"])
+		payloads = append(payloads, string(msg.Payload))
+	}
+
+	want := []string{
+		"messageStart",
+		"contentBlockDelta", "contentBlockDelta", "contentBlockStop",
+		"contentBlockStart", "contentBlockDelta", "contentBlockDelta", "contentBlockStop",
+		"messageStop", "metadata",
+	}
+	if !reflect.DeepEqual(types, want) {
+		t.Fatalf("event types = %v, want %v", types, want)
+	}
+	if !strings.Contains(payloads[1], `"delta":{"text":"Let me read"}`) {
+		t.Errorf("first text delta = %s", payloads[1])
+	}
+	if !strings.Contains(payloads[9], `"usage":{"inputTokens":412,"outputTokens":57,"totalTokens":469}`) {
+		t.Errorf("metadata = %s", payloads[9])
+	}
+}
+
+func TestCorruptStreams(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "converse-stream.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := binary.BigEndian.Uint32(data[0:4])
+
+	badPrelude := bytes.Clone(data)
+	badPrelude[9] ^= 0xff
+	badMessage := bytes.Clone(data)
+	badMessage[first-5] ^= 0xff
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"bad prelude checksum", badPrelude, "prelude checksum mismatch"},
+		{"bad message checksum", badMessage, "message checksum mismatch"},
+		{"truncated message", data[:first+20], io.ErrUnexpectedEOF.Error()},
+		{"truncated prelude", data[:first+5], io.ErrUnexpectedEOF.Error()},
+	}
+	for _, tt := range tests {
+		d := NewDecoder(bytes.NewReader(tt.data))
+		var err error
+		for err == nil {
+			_, err = d.Next()
+		}
+		if err == io.EOF || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestHeaderTypes(t *testing.T) {
+	var headers []byte
+	headers = append(headers, header("true", typeTrue, nil)...)
+	headers = append(headers, header("false", typeFalse, nil)...)
+	headers = append(headers, header("byte", typeByte, []byte{0xfe})...)
+	headers = append(headers, header("short", typeShort, []byte{0xff, 0x85})...)
+	headers = append(headers, header("int", typeInt, []byte{0x00, 0x01, 0xe2, 0x40})...)
+	headers = append(headers, header("long", typeLong, binary.BigEndian.AppendUint64(nil, 1<<40))...)
+	headers = append(headers, header("bytes", typeBytes, []byte{0x00, 0x03, 'a', 'b', 'c'})...)
+	headers = append(headers, header("string", typeString, []byte{0x00, 0x05, 'h', 'e', 'l', 'l', 'o'})...)
+	headers = append(headers, header("timestamp", typeTimestamp, binary.BigEndian.AppendUint64(nil, 1700000000123))...)
+	headers = append(headers, header("uuid", typeUUID, []byte{
+		0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3,
+		0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00,
+	})...)
+
+	msg, err := NewDecoder(bytes.NewReader(frame(headers, []byte("{}")))).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"true":      "true",
+		"false":     "false",
+		"byte":      "-2",
+		"short":     "-123",
+		"int":       "123456",
+		"long":      "1099511627776",
+		"bytes":     "YWJj",
+		"string":    "hello",
+		"timestamp": "2023-11-14T22:13:20.123Z",
+		"uuid":      "123e4567e89b12d3a456426614174000",
+	}
+	if !reflect.DeepEqual(msg.Headers, want) {
+		t.Errorf("headers = %v, want %v", msg.Headers, want)
+	}
+	if string(msg.Payload) != "{}" {
+		t.Errorf("payload = %q, want {}", msg.Payload)
+	}
+
+	if _, err := NewDecoder(bytes.NewReader(frame(header("odd", 42, nil), nil))).Next(); err == nil {
+		t.Error("decoded a header of unknown type")
+	}
+	if _, err := NewDecoder(bytes.NewReader(frame(header("short", typeInt, []byte{0, 1}), nil))).Next(); err == nil {
+		t.Error("decoded a truncated header value")
+	}
+}
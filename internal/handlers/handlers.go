@@ -2,11 +2,13 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 func GetProjectContext() string {
@@ -138,7 +140,8 @@ func ShowDiff(original, new string) string {
 }
 
 func SearchFiles(pattern string) ([]string, error) {
-	cmd := exec.Command("grep", "-r", "-l", pattern, ".")
+	// -e keeps a pattern starting with "-" from being read as an option.
+	cmd := exec.Command("grep", "-r", "-l", "-e", pattern, ".")
 	cmd.Dir, _ = os.Getwd()
 	output, err := cmd.Output()
 	if err != nil {
@@ -218,23 +221,43 @@ func ParseFileEdits(content string) []FileEdit {
 	return edits
 }
 
-func RunCommand(cmdStr string) (string, error) {
+// CommandTimeout is how long a command may run before it is killed.
+const CommandTimeout = 5 * time.Minute
+
+// RunCommand runs the command line in the working directory and returns its
+// output, stdout and stderr interleaved as a terminal would show them. The
+// output is returned on failure too, since tools such as test runners print
+// what went wrong on stdout. The command is killed when ctx is done or after
+// CommandTimeout.
+func RunCommand(ctx context.Context, cmdStr string) (string, error) {
 	parts := strings.Fields(cmdStr)
 	if len(parts) == 0 {
 		return "", fmt.Errorf("empty command")
 	}
 
-	cmd := exec.Command(parts[0], parts[1:]...)
+	runCtx, cancel := context.WithTimeout(ctx, CommandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(runCtx, parts[0], parts[1:]...)
 	cmd.Dir, _ = os.Getwd()
-	
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	
+	// Children that inherited the output pipes could otherwise keep
+	// Wait from returning after the command is killed.
+	cmd.WaitDelay = 5 * time.Second
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
 	err := cmd.Run()
+	if ctx.Err() != nil {
+		return output.String(), fmt.Errorf("command stopped: %w", ctx.Err())
+	}
+	if runCtx.Err() != nil {
+		return output.String(), fmt.Errorf("command timed out after %v", CommandTimeout)
+	}
 	if err != nil {
-		return "", fmt.Errorf("command failed: %v - %s", err, stderr.String())
+		return output.String(), fmt.Errorf("command failed: %w", err)
 	}
-	
-	return stdout.String(), nil
+
+	return output.String(), nil
 }
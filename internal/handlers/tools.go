@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/nexlycode/nexly/internal/permissions"
+	"github.com/nexlycode/nexly/internal/providers"
+)
+
+// Tools returns the definitions of the file and shell helpers in this
+// package, in the form the providers send to the model.
+func Tools() []providers.Tool {
+	return []providers.Tool{
+		{
+			Name:        "read_file",
+			Description: "Read the contents of a file in the project.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{
+						"type":        "string",
+						"description": "Path of the file, relative to the project root.",
+					},
+				},
+				"required": []string{"path"},
+			},
+		},
+		{
+			Name:        "write_file",
+			Description: "Create a file or replace its entire contents.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{
+						"type":        "string",
+						"description": "Path of the file, relative to the project root.",
+					},
+					"content": map[string]interface{}{
+						"type":        "string",
+						"description": "The complete new contents of the file.",
+					},
+				},
+				"required": []string{"path", "content"},
+			},
+		},
+		{
+			Name:        "edit_file",
+			Description: "Replace individual lines of an existing file. An empty new_content deletes the line.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{
+						"type":        "string",
+						"description": "Path of the file, relative to the project root.",
+					},
+					"edits": map[string]interface{}{
+						"type": "array",
+						"items": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"line_number": map[string]interface{}{
+									"type":        "integer",
+									"description": "1-based line number to replace.",
+								},
+								"new_content": map[string]interface{}{
+									"type":        "string",
+									"description": "Replacement text for the line.",
+								},
+							},
+							"required": []string{"line_number", "new_content"},
+						},
+					},
+				},
+				"required": []string{"path", "edits"},
+			},
+		},
+		{
+			Name:        "search_files",
+			Description: "List the files in the project whose contents match a grep pattern.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"pattern": map[string]interface{}{
+						"type":        "string",
+						"description": "Pattern passed to grep.",
+					},
+				},
+				"required": []string{"pattern"},
+			},
+		},
+		{
+			Name:        "run_command",
+			Description: "Run a command in the project directory and return its output.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"command": map[string]interface{}{
+						"type":        "string",
+						"description": "The command line to run.",
+					},
+				},
+				"required": []string{"command"},
+			},
+		},
+	}
+}
+
+// maxToolOutput caps how much of a tool's output is sent back to the model.
+const maxToolOutput = 20000
+
+// ExecuteTool runs the helper named by a tool call and returns its output as
+// text for the model. Commands are stopped when ctx is done.
+func ExecuteTool(ctx context.Context, call providers.ToolCall) (string, error) {
+	var args struct {
+		Path    string `json:"path"`
+		Content string `json:"content"`
+		Pattern string `json:"pattern"`
+		Command string `json:"command"`
+		Edits   []struct {
+			LineNumber int    `json:"line_number"`
+			NewContent string `json:"new_content"`
+		} `json:"edits"`
+	}
+	if err := json.Unmarshal([]byte(call.Arguments), &args); err != nil {
+		return "", fmt.Errorf("invalid arguments for %s: %w", call.Name, err)
+	}
+	// Open the path the permission rules were checked against.
+	args.Path = permissions.CleanPath(args.Path)
+
+	switch call.Name {
+	case "read_file":
+		content, err := ReadFile(args.Path)
+		if err != nil {
+			return "", err
+		}
+		return truncateOutput(content), nil
+	case "write_file":
+		if err := WriteFile(args.Path, args.Content); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Wrote %d bytes to %s", len(args.Content), args.Path), nil
+	case "edit_file":
+		var edits []FileEdit
+		for _, e := range args.Edits {
+			edits = append(edits, FileEdit{LineNumber: e.LineNumber, NewContent: e.NewContent})
+		}
+		if err := EditFile(args.Path, edits); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Applied %d edits to %s", len(edits), args.Path), nil
+	case "search_files":
+		// grep exits non-zero when nothing matches, so an empty result
+		// is reported as such rather than as a failure.
+		files, _ := SearchFiles(args.Pattern)
+		if len(files) == 0 {
+			return "No matching files found.", nil
+		}
+		return truncateOutput(strings.Join(files, "\n")), nil
+	case "run_command":
+		output, err := RunCommand(ctx, args.Command)
+		if err != nil {
+			// The model needs the output to see why the command
+			// failed, not just its exit status.
+			if output != "" {
+				err = fmt.Errorf("%w\n%s", err, truncateOutput(output))
+			}
+			return "", err
+		}
+		return truncateOutput(output), nil
+	default:
+		return "", fmt.Errorf("unknown tool: %s", call.Name)
+	}
+}
+
+func truncateOutput(s string) string {
+	if len(s) <= maxToolOutput {
+		return s
+	}
+	return s[:maxToolOutput] + fmt.Sprintf("\n... (truncated, %d bytes total)", len(s))
+}
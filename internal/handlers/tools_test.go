@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nexlycode/nexly/internal/permissions"
+	"github.com/nexlycode/nexly/internal/providers"
+)
+
+// TestFileToolsOpenTheCheckedPath reads through a symlinked directory and
+// back out with "..": the permission check sees the cleaned path inside
+// the project, so that is the file that must be read.
+func TestFileToolsOpenTheCheckedPath(t *testing.T) {
+	root := t.TempDir()
+	project := filepath.Join(root, "project")
+	outside := filepath.Join(root, "outside")
+	os.MkdirAll(project, 0700)
+	os.MkdirAll(filepath.Join(outside, "sub"), 0700)
+	os.WriteFile(filepath.Join(project, "secret.txt"), []byte("inside"), 0600)
+	os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("outside"), 0600)
+	if err := os.Symlink(filepath.Join(outside, "sub"), filepath.Join(project, "link")); err != nil {
+		t.Skipf("cannot create symlinks: %v", err)
+	}
+
+	wd, _ := os.Getwd()
+	if err := os.Chdir(project); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	call := providers.ToolCall{ID: "call_1", Name: "read_file", Arguments: `{"path":"link/../secret.txt"}`}
+	if subject := permissions.Subject(call); subject != "secret.txt" || !permissions.InProject(subject) {
+		t.Fatalf("checked %q", subject)
+	}
+	got, err := ExecuteTool(context.Background(), call)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "inside" {
+		t.Errorf("read %q, want the project's secret.txt", got)
+	}
+}
@@ -0,0 +1,229 @@
+package permissions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/nexlycode/nexly/internal/providers"
+)
+
+type Action string
+
+const (
+	Allow Action = "allow"
+	Ask   Action = "ask"
+	Deny  Action = "deny"
+)
+
+// Rule decides what happens when the model calls Tool with an argument
+// matching Pattern. Tool may be "*" to match every tool. Pattern is matched
+// against the file path, command line or search pattern of the call; "*"
+// matches any run of characters and "?" a single one. An empty pattern
+// matches everything.
+type Rule struct {
+	Tool    string `json:"tool"`
+	Pattern string `json:"pattern,omitempty"`
+	Action  Action `json:"action"`
+	// InProject limits the rule to paths inside the working directory,
+	// such as "main.go" but not "/etc/passwd" or "../secrets".
+	InProject bool `json:"in_project,omitempty"`
+}
+
+// DefaultRules apply after the configured rules: reading files of the
+// project and searching it are allowed, while reading anything outside it,
+// changing the project or running a program needs confirmation.
+func DefaultRules() []Rule {
+	return []Rule{
+		{Tool: "read_file", Action: Allow, InProject: true},
+		{Tool: "read_file", Action: Ask},
+		{Tool: "search_files", Action: Allow},
+		{Tool: "write_file", Action: Ask},
+		{Tool: "edit_file", Action: Ask},
+		{Tool: "run_command", Action: Ask},
+	}
+}
+
+type Decision int
+
+const (
+	DecisionDeny Decision = iota
+	DecisionAllowOnce
+	DecisionAllowAlways
+)
+
+// Prompter asks the user about a call that no rule allows or denies outright.
+type Prompter func(call providers.ToolCall, subject string) Decision
+
+// Checker evaluates tool calls against a rule set, asking the user when a
+// rule says so. Rules added through "always allow" answers are passed to
+// onAlways so the caller can persist them.
+type Checker struct {
+	rules    []Rule
+	prompt   Prompter
+	onAlways func(Rule)
+}
+
+func NewChecker(rules []Rule, prompt Prompter, onAlways func(Rule)) *Checker {
+	return &Checker{
+		rules:    append(append([]Rule{}, rules...), DefaultRules()...),
+		prompt:   prompt,
+		onAlways: onAlways,
+	}
+}
+
+// Check returns nil if the call may run and an error explaining why not
+// otherwise.
+func (c *Checker) Check(call providers.ToolCall) error {
+	subject := Subject(call)
+
+	switch Evaluate(c.rules, call.Name, subject) {
+	case Allow:
+		return nil
+	case Deny:
+		return fmt.Errorf("permission denied: %s %s is blocked by a deny rule", call.Name, subject)
+	}
+
+	if c.prompt == nil {
+		return fmt.Errorf("permission denied: %s %s needs approval", call.Name, subject)
+	}
+
+	switch c.prompt(call, subject) {
+	case DecisionAllowOnce:
+		return nil
+	case DecisionAllowAlways:
+		rule := Rule{Tool: call.Name, Pattern: escape(subject), Action: Allow}
+		c.rules = append([]Rule{rule}, c.rules...)
+		if c.onAlways != nil {
+			c.onAlways(rule)
+		}
+		return nil
+	default:
+		return fmt.Errorf("permission denied: the user rejected %s %s", call.Name, subject)
+	}
+}
+
+// Evaluate returns the action of the first rule matching the tool and
+// subject, or Ask if none does.
+func Evaluate(rules []Rule, tool, subject string) Action {
+	for _, r := range rules {
+		if r.Tool != "*" && r.Tool != tool {
+			continue
+		}
+		if !Match(r.Pattern, subject) || (r.InProject && !InProject(subject)) {
+			continue
+		}
+		switch r.Action {
+		case Allow, Deny, Ask:
+			return r.Action
+		}
+	}
+	return Ask
+}
+
+// Subject extracts the argument rules are matched against, chosen by the
+// tool: the path for file tools, the command line for run_command and the
+// pattern for search_files. Other fields the model sets are ignored, so a
+// command cannot pass itself off as a harmless path.
+func Subject(call providers.ToolCall) string {
+	var args struct {
+		Path    string `json:"path"`
+		Command string `json:"command"`
+		Pattern string `json:"pattern"`
+	}
+	json.Unmarshal([]byte(call.Arguments), &args)
+
+	switch call.Name {
+	case "run_command":
+		return strings.Join(strings.Fields(args.Command), " ")
+	case "search_files":
+		return args.Pattern
+	case "read_file", "write_file", "edit_file":
+		return filepath.ToSlash(CleanPath(args.Path))
+	}
+	return ""
+}
+
+// CleanPath returns the path the file tools check and then open. Checking
+// one form of the path and opening another would let "link/../x" pass as
+// "x" while the kernel follows link first.
+func CleanPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	return filepath.Clean(filepath.FromSlash(path))
+}
+
+// InProject reports whether the path is inside the working directory: it is
+// relative, does not climb out with "..", and neither it nor the directories
+// above it are symlinks to somewhere outside.
+func InProject(path string) bool {
+	path = filepath.Clean(filepath.FromSlash(path))
+	if filepath.IsAbs(path) || filepath.VolumeName(path) != "" ||
+		path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+		return false
+	}
+
+	// A file that does not exist yet ends up wherever its closest existing
+	// ancestor leads, which may be outside through a symlinked directory.
+	existing := path
+	resolved, err := filepath.EvalSymlinks(existing)
+	for err != nil {
+		if _, lerr := os.Lstat(existing); lerr == nil || !errors.Is(lerr, fs.ErrNotExist) {
+			// It exists but cannot be resolved, such as a dangling symlink
+			// that writing to would create a file at its target.
+			return false
+		}
+		existing = filepath.Dir(existing)
+		resolved, err = filepath.EvalSymlinks(existing)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return false
+	}
+	if root, err := filepath.EvalSymlinks(wd); err == nil {
+		wd = root
+	}
+	abs, err := filepath.Abs(resolved)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(wd, abs)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Match reports whether s matches the glob pattern.
+func Match(pattern, s string) bool {
+	if pattern == "" || pattern == "*" {
+		return true
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+
+	matched, err := regexp.MatchString(expr.String(), s)
+	return err == nil && matched
+}
+
+// escape turns a literal subject into a pattern that only matches itself.
+// Glob characters cannot be escaped, so they are replaced by "?" which still
+// matches them.
+func escape(subject string) string {
+	return strings.NewReplacer("*", "?").Replace(subject)
+}
@@ -0,0 +1,172 @@
+package permissions
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nexlycode/nexly/internal/providers"
+)
+
+func call(name, arguments string) providers.ToolCall {
+	return providers.ToolCall{ID: "call_1", Name: name, Arguments: arguments}
+}
+
+func TestSubjectFollowsTheTool(t *testing.T) {
+	tests := []struct {
+		call providers.ToolCall
+		want string
+	}{
+		{call("run_command", `{"command":"rm -rf .","path":"ls"}`), "rm -rf ."},
+		{call("run_command", `{"command":"go   test\t./..."}`), "go test ./..."},
+		{call("read_file", `{"path":"./src//main.go","command":"ls"}`), "src/main.go"},
+		{call("write_file", `{"path":"a/../b.txt","content":"x"}`), "b.txt"},
+		{call("search_files", `{"pattern":"TODO","path":"ls"}`), "TODO"},
+		{call("unknown_tool", `{"path":"ls"}`), ""},
+	}
+	for _, tt := range tests {
+		if got := Subject(tt.call); got != tt.want {
+			t.Errorf("Subject(%s %s) = %q, want %q", tt.call.Name, tt.call.Arguments, got, tt.want)
+		}
+	}
+}
+
+func TestCommandCannotPassAsAllowedPath(t *testing.T) {
+	prompted := ""
+	checker := NewChecker([]Rule{{Tool: "run_command", Pattern: "ls", Action: Allow}},
+		func(call providers.ToolCall, subject string) Decision {
+			prompted = subject
+			return DecisionDeny
+		}, nil)
+
+	if err := checker.Check(call("run_command", `{"command":"rm -rf .","path":"ls"}`)); err == nil {
+		t.Error("rm -rf . ran under a rule allowing ls")
+	}
+	if prompted != "rm -rf ." {
+		t.Errorf("prompted about %q, want the command", prompted)
+	}
+}
+
+func TestEvaluateFirstMatchWins(t *testing.T) {
+	rules := []Rule{
+		{Tool: "run_command", Pattern: "git push*", Action: Deny},
+		{Tool: "run_command", Pattern: "git *", Action: Allow},
+		{Tool: "*", Pattern: "*.env", Action: Deny},
+		{Tool: "read_file", Action: Allow},
+	}
+	tests := []struct {
+		tool, subject string
+		want          Action
+	}{
+		{"run_command", "git push origin main", Deny},
+		{"run_command", "git status", Allow},
+		{"run_command", "make", Ask},
+		{"read_file", "prod.env", Deny},
+		{"read_file", "main.go", Allow},
+	}
+	for _, tt := range tests {
+		if got := Evaluate(rules, tt.tool, tt.subject); got != tt.want {
+			t.Errorf("Evaluate(%s %s) = %s, want %s", tt.tool, tt.subject, got, tt.want)
+		}
+	}
+}
+
+// inTempProject runs the test in a new project directory next to a
+// directory outside it, whose path it returns.
+func inTempProject(t *testing.T) (outside string) {
+	t.Helper()
+	root := t.TempDir()
+	project := filepath.Join(root, "project")
+	outside = filepath.Join(root, "outside")
+	for _, dir := range []string{filepath.Join(project, "sub"), filepath.Join(outside, "sub")} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(project); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return outside
+}
+
+func TestInProject(t *testing.T) {
+	outside := inTempProject(t)
+	for name, target := range map[string]string{
+		"link":     outside,
+		"dangling": filepath.Join(outside, "missing.txt"),
+		"inner":    "sub",
+	} {
+		if err := os.Symlink(target, name); err != nil {
+			t.Skipf("cannot create symlinks: %v", err)
+		}
+	}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"main.go", true},
+		{"sub/new/file.txt", true},
+		{"inner/file.txt", true},
+		{"./sub/../main.go", true},
+		{"../outside/file.txt", false},
+		{"/etc/passwd", false},
+		{"link", false},
+		{"link/new.txt", false},
+		{"link/a/b.txt", false},
+		{"dangling", false},
+	}
+	for _, tt := range tests {
+		if got := InProject(tt.path); got != tt.want {
+			t.Errorf("InProject(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestAlwaysAllowIsRememberedAndPersisted(t *testing.T) {
+	var persisted []Rule
+	prompts := 0
+	checker := NewChecker(nil, func(call providers.ToolCall, subject string) Decision {
+		prompts++
+		return DecisionAllowAlways
+	}, func(rule Rule) {
+		persisted = append(persisted, rule)
+	})
+
+	test := call("run_command", `{"command":"go test ./..."}`)
+	for i := 0; i < 2; i++ {
+		if err := checker.Check(test); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if prompts != 1 {
+		t.Errorf("prompted %d times, want once", prompts)
+	}
+	want := Rule{Tool: "run_command", Pattern: "go test ./...", Action: Allow}
+	if len(persisted) != 1 || persisted[0] != want {
+		t.Fatalf("persisted %+v, want %+v", persisted, want)
+	}
+
+	// A checker built from the saved rules allows the call without asking.
+	restored := NewChecker(persisted, nil, nil)
+	if err := restored.Check(test); err != nil {
+		t.Errorf("saved rule not honored: %v", err)
+	}
+	if err := restored.Check(call("run_command", `{"command":"go test ./... && rm -rf ."}`)); err == nil {
+		t.Error("saved rule allowed a longer command")
+	}
+
+	answer := DecisionAllowAlways
+	glob := NewChecker(nil, func(providers.ToolCall, string) Decision { return answer }, nil)
+	glob.Check(call("run_command", `{"command":"echo *"}`))
+	answer = DecisionDeny
+	if err := glob.Check(call("run_command", `{"command":"echo anything"}`)); err == nil {
+		t.Error("always allowing a command with * allowed any command")
+	}
+}
@@ -0,0 +1,323 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/nexlycode/nexly/internal/sse"
+)
+
+func init() {
+	Register(&anthropicAdapter{})
+}
+
+// anthropicAdapter speaks the Anthropic Messages API.
+type anthropicAdapter struct{}
+
+func (a *anthropicAdapter) Name() string {
+	return "anthropic"
+}
+
+func (a *anthropicAdapter) Models() []string {
+	return catalogModels(a.Name())
+}
+
+func (a *anthropicAdapter) Limits() Limits {
+	return Limits{MaxTemperature: 1, MinThinkingBudget: 1024}
+}
+
+func (a *anthropicAdapter) RequiresKey() bool {
+	return true
+}
+
+func (a *anthropicAdapter) Endpoint(model string) string {
+	return "https://api.anthropic.com/v1/messages"
+}
+
+func (a *anthropicAdapter) BuildRequest(model string, req Request, gen GenerationConfig) map[string]interface{} {
+	var systemMsg string
+	var userMsgs []Message
+	for _, m := range req.Messages {
+		if m.Role == "system" {
+			systemMsg = m.Text()
+		} else {
+			userMsgs = append(userMsgs, m)
+		}
+	}
+	body := map[string]interface{}{
+		"model":    model,
+		"messages": formatAnthropicMessages(userMsgs),
+		"stream":   true,
+	}
+	gen.applyAnthropic(body)
+	if systemMsg != "" {
+		body["system"] = systemMsg
+	}
+	if len(req.Tools) > 0 {
+		body["tools"] = formatAnthropicTools(req.Tools)
+	}
+	return body
+}
+
+func (a *anthropicAdapter) SetHeaders(header http.Header, apiKey string) {
+	header.Set("x-api-key", apiKey)
+	header.Set("anthropic-version", "2023-06-01")
+	header.Set("Content-Type", "application/json")
+}
+
+func (a *anthropicAdapter) DecodeStream(body io.Reader, emit EventHandler) (*Response, error) {
+	var content, thinking strings.Builder
+	var signature string
+	var calls toolCallBuilder
+	var usage Usage
+	var stopReason string
+	stopped := false
+
+	events := sse.NewDecoder(body)
+	for {
+		event, err := events.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+
+		data := event.Data
+
+		var response struct {
+			Index        int `json:"index"`
+			ContentBlock struct {
+				Type string `json:"type"`
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"content_block"`
+			Delta struct {
+				Type        string `json:"type"`
+				Text        string `json:"text"`
+				PartialJSON string `json:"partial_json"`
+				Thinking    string `json:"thinking"`
+				Signature   string `json:"signature"`
+				StopReason  string `json:"stop_reason"`
+			} `json:"delta"`
+			Message struct {
+				Usage anthropicUsage `json:"usage"`
+			} `json:"message"`
+			Usage anthropicUsage `json:"usage"`
+		}
+
+		if err := json.Unmarshal([]byte(data), &response); err != nil {
+			return nil, fmt.Errorf("decoding stream event: %w", err)
+		}
+
+		// The event name says what the event is; its data repeats it as
+		// "type".
+		switch event.Type {
+		case "error":
+			// For example when the API is overloaded after the
+			// response has started.
+			if err := decodeStreamError([]byte(data)); err != nil {
+				return nil, err
+			}
+			return nil, &StreamError{Message: data}
+		case "message_stop":
+			stopped = true
+		case "message_start":
+			u := response.Message.Usage
+			usage.InputTokens = u.InputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens
+			usage.CachedTokens = u.CacheReadInputTokens
+			usage.OutputTokens = u.OutputTokens
+		case "message_delta":
+			// The output count in message_delta is cumulative.
+			usage.OutputTokens = response.Usage.OutputTokens
+			if response.Delta.StopReason != "" {
+				stopReason = anthropicStopReason(response.Delta.StopReason)
+			}
+		case "content_block_start":
+			if response.ContentBlock.Type == "tool_use" {
+				call := calls.get(response.Index)
+				call.ID = response.ContentBlock.ID
+				call.Name = response.ContentBlock.Name
+				emit(Event{Type: EventToolCall, ToolCall: ToolCallDelta{
+					Index: response.Index,
+					ID:    call.ID,
+					Name:  call.Name,
+				}})
+			}
+		case "content_block_delta":
+			switch response.Delta.Type {
+			case "input_json_delta":
+				if calls.has(response.Index) {
+					calls.get(response.Index).Arguments += response.Delta.PartialJSON
+					emit(Event{Type: EventToolCall, ToolCall: ToolCallDelta{
+						Index:     response.Index,
+						Arguments: response.Delta.PartialJSON,
+					}})
+				}
+				continue
+			case "thinking_delta":
+				thinking.WriteString(response.Delta.Thinking)
+				emit(Event{Type: EventThinking, Text: response.Delta.Thinking})
+				continue
+			case "signature_delta":
+				signature += response.Delta.Signature
+				continue
+			}
+			if response.Delta.Text != "" {
+				content.WriteString(response.Delta.Text)
+				emit(Event{Type: EventText, Text: response.Delta.Text})
+			}
+		}
+	}
+
+	if !stopped {
+		return nil, errIncompleteStream
+	}
+	if stopReason == StopContentFilter {
+		return nil, filteredError("stop_reason refusal")
+	}
+
+	return &Response{
+		Content:           content.String(),
+		ToolCalls:         calls.result(),
+		Thinking:          thinking.String(),
+		ThinkingSignature: signature,
+		Usage:             usage,
+		StopReason:        stopReason,
+	}, nil
+}
+
+// anthropicStopReason maps a stop_reason to a Stop constant.
+func anthropicStopReason(reason string) string {
+	switch reason {
+	case "end_turn":
+		return StopEnd
+	case "max_tokens":
+		return StopMaxTokens
+	case "tool_use":
+		return StopToolUse
+	case "stop_sequence":
+		return StopSequence
+	case "refusal":
+		return StopContentFilter
+	}
+	return reason
+}
+
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+}
+
+func (a *anthropicAdapter) ModelsEndpoint() string {
+	return "https://api.anthropic.com/v1/models?limit=1000"
+}
+
+func (a *anthropicAdapter) DecodeModels(body io.Reader) ([]ModelInfo, error) {
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(body).Decode(&list); err != nil {
+		return nil, err
+	}
+
+	// The listing has no limits, but every Claude model has a 200k
+	// context window.
+	var models []ModelInfo
+	for _, m := range list.Data {
+		models = append(models, ModelInfo{Name: m.ID, ContextWindow: 200000})
+	}
+	return models, nil
+}
+
+// formatAnthropicMessages converts the conversation to content blocks. Tool
+// results are sent as user turns, and consecutive turns of the same role are
+// merged since the API requires roles to alternate.
+func formatAnthropicMessages(messages []Message) []map[string]interface{} {
+	result := []map[string]interface{}{}
+	for _, m := range messages {
+		role := m.Role
+		if role == "tool" {
+			role = "user"
+		}
+
+		var blocks []map[string]interface{}
+		for _, b := range m.Content {
+			switch b.Type {
+			case BlockText:
+				if b.Text != "" {
+					blocks = append(blocks, map[string]interface{}{
+						"type": "text",
+						"text": b.Text,
+					})
+				}
+			case BlockThinking:
+				// Thinking can only be sent back with the signature
+				// that proves it came from the model.
+				if b.Text != "" && b.Signature != "" {
+					blocks = append(blocks, map[string]interface{}{
+						"type":      "thinking",
+						"thinking":  b.Text,
+						"signature": b.Signature,
+					})
+				}
+			case BlockImage:
+				blocks = append(blocks, map[string]interface{}{
+					"type": "image",
+					"source": map[string]interface{}{
+						"type":       "base64",
+						"media_type": b.Image.MediaType,
+						"data":       b.Image.base64Data(),
+					},
+				})
+			case BlockToolCall:
+				blocks = append(blocks, map[string]interface{}{
+					"type":  "tool_use",
+					"id":    b.ToolCall.ID,
+					"name":  b.ToolCall.Name,
+					"input": json.RawMessage(rawArguments(json.RawMessage(b.ToolCall.Arguments))),
+				})
+			case BlockToolResult:
+				blocks = append(blocks, map[string]interface{}{
+					"type":        "tool_result",
+					"tool_use_id": b.ToolResult.CallID,
+					"content":     b.ToolResult.Content,
+				})
+			}
+		}
+
+		if len(blocks) == 0 {
+			continue
+		}
+
+		if n := len(result); n > 0 && result[n-1]["role"] == role {
+			prev := result[n-1]["content"].([]map[string]interface{})
+			result[n-1]["content"] = append(prev, blocks...)
+			continue
+		}
+		result = append(result, map[string]interface{}{
+			"role":    role,
+			"content": blocks,
+		})
+	}
+	return result
+}
+
+func formatAnthropicTools(tools []Tool) []map[string]interface{} {
+	result := []map[string]interface{}{}
+	for _, t := range tools {
+		result = append(result, map[string]interface{}{
+			"name":         t.Name,
+			"description":  t.Description,
+			"input_schema": t.Parameters,
+		})
+	}
+	return result
+}
@@ -0,0 +1,117 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultAzureAPIVersion is the Azure OpenAI API version used when none is
+// configured.
+const DefaultAzureAPIVersion = "2024-10-21"
+
+// azureDeploymentsVersion is the API version of the deployments listing,
+// which later versions no longer serve.
+const azureDeploymentsVersion = "2022-12-01"
+
+func init() {
+	// Registered without an endpoint so the provider is listed; requests
+	// go through an adapter built from the config's settings.
+	Register(NewAzureAdapter("", "", nil))
+	RegisterFactory("azure", newAzureFromSettings)
+}
+
+// AzureSettings locate an Azure OpenAI resource. Its key goes under the
+// API keys as "azure", and its deployments are used as the models.
+type AzureSettings struct {
+	Endpoint    string   `json:"endpoint,omitempty"`
+	APIVersion  string   `json:"api_version,omitempty"`
+	Deployments []string `json:"deployments,omitempty"`
+}
+
+func newAzureFromSettings(raw json.RawMessage) (Adapter, error) {
+	var s AzureSettings
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, fmt.Errorf("reading the azure settings: %w", err)
+	}
+	if s.Endpoint == "" {
+		return nil, fmt.Errorf("set the endpoint of your Azure OpenAI resource under provider_settings.azure.endpoint in the config")
+	}
+	return NewAzureAdapter(s.Endpoint, s.APIVersion, s.Deployments), nil
+}
+
+// azureAdapter speaks the Azure OpenAI chat completions API. Requests go to
+// a deployment of the resource, named in place of the model, with the API
+// version in the query and the key in an api-key header. The bodies and
+// the stream are the OpenAI ones.
+type azureAdapter struct {
+	openAIAdapter
+	endpoint   string
+	apiVersion string
+}
+
+// NewAzureAdapter returns an adapter for the Azure OpenAI resource at
+// endpoint, e.g. "https://my-resource.openai.azure.com". deployments are
+// the deployment names offered as models.
+func NewAzureAdapter(endpoint, apiVersion string, deployments []string) Adapter {
+	if apiVersion == "" {
+		apiVersion = DefaultAzureAPIVersion
+	}
+	return &azureAdapter{
+		openAIAdapter: openAIAdapter{
+			name:        "azure",
+			models:      deployments,
+			requiresKey: true,
+		},
+		endpoint:   strings.TrimRight(endpoint, "/"),
+		apiVersion: apiVersion,
+	}
+}
+
+// Models returns the configured deployments along with the ones found by
+// the last refresh.
+func (a *azureAdapter) Models() []string {
+	return withDiscovered(a.name, a.models)
+}
+
+func (a *azureAdapter) Endpoint(model string) string {
+	return a.endpoint + "/openai/deployments/" + url.PathEscape(model) +
+		"/chat/completions?api-version=" + url.QueryEscape(a.apiVersion)
+}
+
+func (a *azureAdapter) SetHeaders(header http.Header, apiKey string) {
+	header.Set("api-key", apiKey)
+	header.Set("Content-Type", "application/json")
+}
+
+func (a *azureAdapter) ModelsEndpoint() string {
+	return a.endpoint + "/openai/deployments?api-version=" + azureDeploymentsVersion
+}
+
+// DecodeModels reads the deployments listing. Each deployment is described
+// by the catalog entry of the model it serves.
+func (a *azureAdapter) DecodeModels(body io.Reader) ([]ModelInfo, error) {
+	var list struct {
+		Data []struct {
+			ID    string `json:"id"`
+			Model string `json:"model"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(body).Decode(&list); err != nil {
+		return nil, err
+	}
+
+	var models []ModelInfo
+	for _, d := range list.Data {
+		if !chatModel(d.Model) {
+			continue
+		}
+		info, _ := LookupModel(d.Model)
+		info.Name = d.ID
+		models = append(models, info)
+	}
+	return models, nil
+}
@@ -0,0 +1,149 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// azureStandIn serves the chat completions of one deployment the way an
+// Azure OpenAI resource does, failing the test on requests to anything else.
+func azureStandIn(t *testing.T, deployment string, reply func(w http.ResponseWriter)) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if want := "/openai/deployments/" + deployment + "/chat/completions"; r.URL.Path != want {
+			t.Errorf("path = %s, want %s", r.URL.Path, want)
+		}
+		if got := r.URL.Query().Get("api-version"); got != DefaultAzureAPIVersion {
+			t.Errorf("api-version = %q, want %q", got, DefaultAzureAPIVersion)
+		}
+		if got := r.Header.Get("api-key"); got != "test-key" {
+			t.Errorf("api-key header = %q, want test-key", got)
+		}
+		if got := r.Header.Get("Authorization"); got != "" {
+			t.Errorf("unexpected Authorization header %q", got)
+		}
+		reply(w)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newAzureProvider(t *testing.T, endpoint, deployment string) *SimpleProvider {
+	t.Helper()
+	settings, _ := json.Marshal(AzureSettings{Endpoint: endpoint, Deployments: []string{deployment}})
+	adapter, err := Configure("azure", settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewSimpleProvider(adapter, "test-key", deployment)
+	p.SetRetry(RetryPolicy{MaxAttempts: 1}, nil)
+	return p
+}
+
+func TestAzureStream(t *testing.T) {
+	srv := azureStandIn(t, "my-gpt-4o", func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`data: {"choices":[],"prompt_filter_results":[{"prompt_index":0,"content_filter_results":{}}]}
+
+data: {"choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"},"finish_reason":null}]}
+
+data: {"choices":[{"index":0,"delta":{"content":"lo"},"finish_reason":null}]}
+
+data: {"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}
+
+data: [DONE]
+
+`))
+	})
+
+	resp, err := newAzureProvider(t, srv.URL, "my-gpt-4o").SendMessage(context.Background(), Request{
+		Messages: []Message{TextMessage("user", "Hi")},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "Hello" || resp.StopReason != StopEnd {
+		t.Errorf("got %q stopped by %q, want Hello stopped by %q", resp.Content, resp.StopReason, StopEnd)
+	}
+}
+
+func TestAzureContentFilter(t *testing.T) {
+	srv := azureStandIn(t, "my-gpt-4o", func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"message":"The response was filtered due to the prompt triggering Azure OpenAI's content management policy.","type":null,"param":"prompt","code":"content_filter","status":400,"innererror":{"code":"ResponsibleAIPolicyViolation","content_filter_result":{"hate":{"filtered":true,"severity":"high"},"jailbreak":{"filtered":true,"detected":true},"self_harm":{"filtered":false,"severity":"safe"},"sexual":{"filtered":false,"severity":"safe"},"violence":{"filtered":false,"severity":"safe"}}}}}`))
+	})
+
+	_, err := newAzureProvider(t, srv.URL, "my-gpt-4o").SendMessage(context.Background(), Request{
+		Messages: []Message{TextMessage("user", "Hi")},
+	}, nil)
+	if !errors.Is(err, ErrContentFiltered) {
+		t.Fatalf("got %v, want ErrContentFiltered", err)
+	}
+	if !strings.Contains(err.Error(), "(filtered: hate, jailbreak)") {
+		t.Errorf("error %q does not name the filtered categories", err)
+	}
+}
+
+// TestAzureDeploymentNamedApart refreshes the models of a resource with an
+// o3 deployment named "reasoner", then sends it a request: it has to be
+// described as o3, with reasoning and without sampling settings.
+func TestAzureDeploymentNamedApart(t *testing.T) {
+	t.Cleanup(func() { SetDiscoveredModels("azure", nil) })
+
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/openai/deployments":
+			w.Write([]byte(`{"data":[{"id":"reasoner","model":"o3","status":"succeeded","object":"deployment"}],"object":"list"}`))
+		case "/openai/deployments/reasoner/chat/completions":
+			json.NewDecoder(r.Body).Decode(&body)
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n"))
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	p := newAzureProvider(t, srv.URL, "reasoner")
+	models, err := p.ListModels(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetDiscoveredModels("azure", models)
+
+	info, ok := LookupModel("reasoner")
+	if !ok || !info.Reasoning || info.Temperature || info.ContextWindow != 200000 {
+		t.Fatalf("reasoner described as %+v, %v", info, ok)
+	}
+
+	temperature := 0.7
+	p.SetGeneration(GenerationConfig{Temperature: &temperature, MaxTokens: 2000, ReasoningEffort: "high"})
+	if _, err := p.SendMessage(context.Background(), Request{
+		Messages: []Message{TextMessage("user", "Hi")},
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := body["temperature"]; ok {
+		t.Error("sent a temperature to a reasoning model")
+	}
+	if body["max_completion_tokens"] != float64(2000) || body["max_tokens"] != nil {
+		t.Errorf("reply limit sent as max_tokens=%v max_completion_tokens=%v", body["max_tokens"], body["max_completion_tokens"])
+	}
+	if body["reasoning_effort"] != "high" {
+		t.Errorf("reasoning_effort = %v, want high", body["reasoning_effort"])
+	}
+}
+
+func TestAzureRequiresEndpoint(t *testing.T) {
+	if _, err := Configure("azure", nil); err == nil {
+		t.Error("configured azure without an endpoint")
+	}
+}
@@ -0,0 +1,424 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nexlycode/nexly/internal/eventstream"
+)
+
+// DefaultBedrockRegion is the AWS region used when neither the config nor
+// the environment names one.
+const DefaultBedrockRegion = "us-east-1"
+
+func init() {
+	// Registered with the region from the environment so the provider is
+	// listed; requests go through an adapter built from the config's
+	// settings.
+	Register(NewBedrockAdapter("", "", "", nil))
+	RegisterFactory("bedrock", newBedrockFromSettings)
+}
+
+// BedrockSettings configure Amazon Bedrock. Endpoint replaces the AWS URLs,
+// and Models adds model IDs or inference profiles to the ones offered.
+type BedrockSettings struct {
+	Region   string   `json:"region,omitempty"`
+	Profile  string   `json:"profile,omitempty"`
+	Endpoint string   `json:"endpoint,omitempty"`
+	Models   []string `json:"models,omitempty"`
+}
+
+func newBedrockFromSettings(raw json.RawMessage) (Adapter, error) {
+	var s BedrockSettings
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, fmt.Errorf("reading the bedrock settings: %w", err)
+	}
+	return NewBedrockAdapter(s.Region, s.Profile, s.Endpoint, s.Models), nil
+}
+
+// bedrockAdapter speaks the Amazon Bedrock Converse API, which serves the
+// Claude and Llama models with one request format. Requests are signed with
+// AWS Signature Version 4 rather than sent with a key, and the reply streams
+// in AWS's binary event stream framing.
+type bedrockAdapter struct {
+	region  string
+	profile string
+	// endpoint replaces the regional runtime and control plane URLs, for
+	// VPC endpoints and local stand-ins.
+	endpoint string
+	models   []string
+}
+
+// NewBedrockAdapter returns an adapter for Bedrock in region, signing with
+// the credentials of the environment or of profile in the shared
+// credentials file. An empty region is taken from AWS_REGION or
+// AWS_DEFAULT_REGION. models are offered along with the catalog's, for
+// model IDs and inference profiles it does not list.
+func NewBedrockAdapter(region, profile, endpoint string, models []string) Adapter {
+	for _, r := range []string{region, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), DefaultBedrockRegion} {
+		if r != "" {
+			region = r
+			break
+		}
+	}
+	return &bedrockAdapter{
+		region:   region,
+		profile:  profile,
+		endpoint: strings.TrimRight(endpoint, "/"),
+		models:   models,
+	}
+}
+
+func (a *bedrockAdapter) Name() string {
+	return "bedrock"
+}
+
+func (a *bedrockAdapter) Models() []string {
+	names := catalogModels(a.Name())
+	for _, m := range a.models {
+		if !slices.Contains(names, m) {
+			names = append(names, m)
+		}
+	}
+	return names
+}
+
+func (a *bedrockAdapter) Limits() Limits {
+	return Limits{MaxTemperature: 1}
+}
+
+// RequiresKey is false since requests are signed with AWS credentials,
+// which SignRequest looks up.
+func (a *bedrockAdapter) RequiresKey() bool {
+	return false
+}
+
+func (a *bedrockAdapter) Endpoint(model string) string {
+	base := a.endpoint
+	if base == "" {
+		base = "https://bedrock-runtime." + a.region + ".amazonaws.com"
+	}
+	// Model IDs contain colons, which have to be escaped in the path.
+	return base + "/model/" + awsURIEncode(model, true) + "/converse-stream"
+}
+
+func (a *bedrockAdapter) BuildRequest(model string, req Request, gen GenerationConfig) map[string]interface{} {
+	var system []map[string]interface{}
+	var msgs []Message
+	for _, m := range req.Messages {
+		if m.Role == "system" {
+			if text := m.Text(); text != "" {
+				system = append(system, map[string]interface{}{"text": text})
+			}
+		} else {
+			msgs = append(msgs, m)
+		}
+	}
+
+	body := map[string]interface{}{
+		"messages":        formatBedrockMessages(msgs),
+		"inferenceConfig": gen.bedrockConfig(),
+	}
+	if len(system) > 0 {
+		body["system"] = system
+	}
+	if len(req.Tools) > 0 {
+		body["toolConfig"] = map[string]interface{}{
+			"tools": formatBedrockTools(req.Tools),
+		}
+	}
+	return body
+}
+
+func (a *bedrockAdapter) SetHeaders(header http.Header, apiKey string) {
+	header.Set("Content-Type", "application/json")
+}
+
+// SignRequest signs the request with the AWS credentials, which are looked
+// up for every request so refreshed ones are picked up.
+func (a *bedrockAdapter) SignRequest(req *http.Request, body []byte) error {
+	creds, err := loadAWSCredentials(a.profile)
+	if err != nil {
+		return err
+	}
+	signV4(req, body, creds, a.region, "bedrock", time.Now())
+	return nil
+}
+
+func (a *bedrockAdapter) DecodeStream(body io.Reader, emit EventHandler) (*Response, error) {
+	var content, thinking strings.Builder
+	var signature string
+	var calls toolCallBuilder
+	var usage Usage
+	var stopReason, rawStopReason string
+	stopped := false
+
+	messages := eventstream.NewDecoder(body)
+	for {
+		msg, err := messages.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+
+		switch msg.Headers[":message-type"] {
+		case "exception":
+			// For example a throttlingException once the reply has
+			// started.
+			return nil, bedrockStreamError(msg.Headers[":exception-type"], msg.Payload)
+		case "error":
+			return nil, &StreamError{
+				Kind:    errorCodes[msg.Headers[":error-code"]],
+				Message: msg.Headers[":error-message"],
+			}
+		}
+
+		var event struct {
+			ContentBlockIndex int `json:"contentBlockIndex"`
+			Start             struct {
+				ToolUse struct {
+					ToolUseID string `json:"toolUseId"`
+					Name      string `json:"name"`
+				} `json:"toolUse"`
+			} `json:"start"`
+			Delta struct {
+				Text    string `json:"text"`
+				ToolUse struct {
+					Input string `json:"input"`
+				} `json:"toolUse"`
+				ReasoningContent struct {
+					Text      string `json:"text"`
+					Signature string `json:"signature"`
+				} `json:"reasoningContent"`
+			} `json:"delta"`
+			StopReason string `json:"stopReason"`
+			Usage      struct {
+				InputTokens          int `json:"inputTokens"`
+				OutputTokens         int `json:"outputTokens"`
+				CacheReadInputTokens int `json:"cacheReadInputTokens"`
+			} `json:"usage"`
+		}
+		if err := json.Unmarshal(msg.Payload, &event); err != nil {
+			return nil, fmt.Errorf("decoding stream event: %w", err)
+		}
+
+		index := event.ContentBlockIndex
+		switch msg.Headers[":event-type"] {
+		case "contentBlockStart":
+			if start := event.Start.ToolUse; start.Name != "" {
+				call := calls.get(index)
+				call.ID = start.ToolUseID
+				call.Name = start.Name
+				emit(Event{Type: EventToolCall, ToolCall: ToolCallDelta{
+					Index: index,
+					ID:    call.ID,
+					Name:  call.Name,
+				}})
+			}
+		case "contentBlockDelta":
+			delta := event.Delta
+			if input := delta.ToolUse.Input; input != "" && calls.has(index) {
+				calls.get(index).Arguments += input
+				emit(Event{Type: EventToolCall, ToolCall: ToolCallDelta{
+					Index:     index,
+					Arguments: input,
+				}})
+			}
+			if text := delta.ReasoningContent.Text; text != "" {
+				thinking.WriteString(text)
+				emit(Event{Type: EventThinking, Text: text})
+			}
+			signature += delta.ReasoningContent.Signature
+			if delta.Text != "" {
+				content.WriteString(delta.Text)
+				emit(Event{Type: EventText, Text: delta.Text})
+			}
+		case "messageStop":
+			rawStopReason = event.StopReason
+			stopReason = bedrockStopReason(rawStopReason)
+			stopped = true
+		case "metadata":
+			// Converse counts the prompt tokens read from the cache
+			// apart from the others.
+			u := event.Usage
+			usage.InputTokens = u.InputTokens + u.CacheReadInputTokens
+			usage.CachedTokens = u.CacheReadInputTokens
+			usage.OutputTokens = u.OutputTokens
+		}
+	}
+
+	if !stopped {
+		return nil, errIncompleteStream
+	}
+	if stopReason == StopContentFilter {
+		return nil, filteredError("stopReason " + rawStopReason)
+	}
+
+	return &Response{
+		Content:           content.String(),
+		ToolCalls:         calls.result(),
+		Thinking:          thinking.String(),
+		ThinkingSignature: signature,
+		Usage:             usage,
+		StopReason:        stopReason,
+	}, nil
+}
+
+// bedrockStreamError returns the error carried by an exception message. The
+// stream names exceptions in lower camel case, as in "throttlingException",
+// where error responses use "ThrottlingException".
+func bedrockStreamError(exceptionType string, payload []byte) error {
+	var body struct {
+		Message string `json:"message"`
+	}
+	json.Unmarshal(payload, &body)
+	if body.Message == "" {
+		body.Message = string(payload)
+	}
+
+	code := exceptionType
+	if code != "" {
+		code = strings.ToUpper(code[:1]) + code[1:]
+	}
+	return &StreamError{Kind: errorCodes[code], Message: fmt.Sprintf("%s: %s", code, body.Message)}
+}
+
+// bedrockStopReason maps a Converse stopReason to a Stop constant.
+func bedrockStopReason(reason string) string {
+	switch reason {
+	case "end_turn":
+		return StopEnd
+	case "max_tokens":
+		return StopMaxTokens
+	case "tool_use":
+		return StopToolUse
+	case "stop_sequence":
+		return StopSequence
+	case "guardrail_intervened", "content_filtered":
+		return StopContentFilter
+	}
+	return reason
+}
+
+// ModelsEndpoint lists the foundation models that stream text on demand.
+// The listing is served by the Bedrock control plane, not the runtime.
+func (a *bedrockAdapter) ModelsEndpoint() string {
+	base := a.endpoint
+	if base == "" {
+		base = "https://bedrock." + a.region + ".amazonaws.com"
+	}
+	return base + "/foundation-models?byInferenceType=ON_DEMAND&byOutputModality=TEXT"
+}
+
+func (a *bedrockAdapter) DecodeModels(body io.Reader) ([]ModelInfo, error) {
+	var list struct {
+		ModelSummaries []struct {
+			ModelID                    string   `json:"modelId"`
+			InputModalities            []string `json:"inputModalities"`
+			ResponseStreamingSupported bool     `json:"responseStreamingSupported"`
+		} `json:"modelSummaries"`
+	}
+	if err := json.NewDecoder(body).Decode(&list); err != nil {
+		return nil, err
+	}
+
+	var models []ModelInfo
+	for _, m := range list.ModelSummaries {
+		if !m.ResponseStreamingSupported {
+			continue
+		}
+		info := listedModel(m.ModelID)
+		info.Vision = slices.Contains(m.InputModalities, "IMAGE")
+		models = append(models, info)
+	}
+	return models, nil
+}
+
+// formatBedrockMessages converts the conversation to Converse content
+// blocks. Tool results are sent as user turns, and consecutive turns of the
+// same role are merged since the API requires roles to alternate. Thinking
+// is left out, as it is never turned on for Bedrock.
+func formatBedrockMessages(messages []Message) []map[string]interface{} {
+	result := []map[string]interface{}{}
+	for _, m := range messages {
+		role := m.Role
+		if role == "tool" {
+			role = "user"
+		}
+
+		var blocks []map[string]interface{}
+		for _, b := range m.Content {
+			switch b.Type {
+			case BlockText:
+				if b.Text != "" {
+					blocks = append(blocks, map[string]interface{}{"text": b.Text})
+				}
+			case BlockImage:
+				blocks = append(blocks, map[string]interface{}{
+					"image": map[string]interface{}{
+						"format": strings.TrimPrefix(b.Image.MediaType, "image/"),
+						"source": map[string]interface{}{
+							"bytes": b.Image.base64Data(),
+						},
+					},
+				})
+			case BlockToolCall:
+				blocks = append(blocks, map[string]interface{}{
+					"toolUse": map[string]interface{}{
+						"toolUseId": b.ToolCall.ID,
+						"name":      b.ToolCall.Name,
+						"input":     json.RawMessage(rawArguments(json.RawMessage(b.ToolCall.Arguments))),
+					},
+				})
+			case BlockToolResult:
+				blocks = append(blocks, map[string]interface{}{
+					"toolResult": map[string]interface{}{
+						"toolUseId": b.ToolResult.CallID,
+						"content": []map[string]interface{}{
+							{"text": b.ToolResult.Content},
+						},
+					},
+				})
+			}
+		}
+
+		if len(blocks) == 0 {
+			continue
+		}
+
+		if n := len(result); n > 0 && result[n-1]["role"] == role {
+			prev := result[n-1]["content"].([]map[string]interface{})
+			result[n-1]["content"] = append(prev, blocks...)
+			continue
+		}
+		result = append(result, map[string]interface{}{
+			"role":    role,
+			"content": blocks,
+		})
+	}
+	return result
+}
+
+func formatBedrockTools(tools []Tool) []map[string]interface{} {
+	result := []map[string]interface{}{}
+	for _, t := range tools {
+		result = append(result, map[string]interface{}{
+			"toolSpec": map[string]interface{}{
+				"name":        t.Name,
+				"description": t.Description,
+				"inputSchema": map[string]interface{}{
+					"json": t.Parameters,
+				},
+			},
+		})
+	}
+	return result
+}
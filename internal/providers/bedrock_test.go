@@ -0,0 +1,173 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const bedrockTestModel = "anthropic.claude-3-5-sonnet-20240620-v1:0"
+
+// eventMessage frames a message of an AWS event stream with string headers.
+func eventMessage(headers map[string]string, payload string) []byte {
+	var h []byte
+	for name, value := range headers {
+		h = append(h, byte(len(name)))
+		h = append(h, name...)
+		h = append(h, 7) // string
+		h = binary.BigEndian.AppendUint16(h, uint16(len(value)))
+		h = append(h, value...)
+	}
+	total := 12 + len(h) + len(payload) + 4
+	msg := binary.BigEndian.AppendUint32(nil, uint32(total))
+	msg = binary.BigEndian.AppendUint32(msg, uint32(len(h)))
+	msg = binary.BigEndian.AppendUint32(msg, crc32.ChecksumIEEE(msg))
+	msg = append(msg, h...)
+	msg = append(msg, payload...)
+	return binary.BigEndian.AppendUint32(msg, crc32.ChecksumIEEE(msg))
+}
+
+func converseEvent(eventType, payload string) []byte {
+	return eventMessage(map[string]string{
+		":event-type":   eventType,
+		":content-type": "application/json",
+		":message-type": "event",
+	}, payload)
+}
+
+// bedrockStandIn serves ConverseStream for one model the way the Bedrock
+// runtime does, checking that the request is signed with the test
+// credentials by signing it again.
+func bedrockStandIn(t *testing.T, model string, stream ...[]byte) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if want := "/model/" + strings.ReplaceAll(model, ":", "%3A") + "/converse-stream"; r.URL.EscapedPath() != want {
+			t.Errorf("path = %s, want %s", r.URL.EscapedPath(), want)
+		}
+		body, _ := io.ReadAll(r.Body)
+		checkBedrockSignature(t, r, body)
+
+		w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+		for _, msg := range stream {
+			w.Write(msg)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func checkBedrockSignature(t *testing.T, r *http.Request, body []byte) {
+	t.Helper()
+	auth := r.Header.Get("Authorization")
+	date := r.Header.Get("X-Amz-Date")
+	if want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/" + date[:8] + "/us-west-2/bedrock/aws4_request, "; !strings.HasPrefix(auth, want) {
+		t.Fatalf("Authorization = %q, want it to start with %q", auth, want)
+	}
+	_, signed, _ := strings.Cut(auth, "SignedHeaders=")
+	signed, _, _ = strings.Cut(signed, ",")
+
+	resigned, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	for _, name := range strings.Split(signed, ";") {
+		if name != "host" && name != "x-amz-date" {
+			resigned.Header.Set(name, r.Header.Get(name))
+		}
+	}
+	now, err := time.Parse("20060102T150405Z", date)
+	if err != nil {
+		t.Fatalf("X-Amz-Date = %q: %v", date, err)
+	}
+	signV4(resigned, body, sigv4TestCreds, "us-west-2", "bedrock", now)
+	if got := resigned.Header.Get("Authorization"); got != auth {
+		t.Errorf("signature does not match the request:\n got  %s\n want %s", auth, got)
+	}
+}
+
+func newBedrockProvider(t *testing.T, endpoint, model string) *SimpleProvider {
+	t.Helper()
+	t.Setenv("AWS_ACCESS_KEY_ID", sigv4TestCreds.AccessKeyID)
+	t.Setenv("AWS_SECRET_ACCESS_KEY", sigv4TestCreds.SecretAccessKey)
+	t.Setenv("AWS_SESSION_TOKEN", "")
+
+	settings, _ := json.Marshal(BedrockSettings{Region: "us-west-2", Endpoint: endpoint})
+	adapter, err := Configure("bedrock", settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewSimpleProvider(adapter, "", model)
+	p.SetRetry(RetryPolicy{MaxAttempts: 1}, nil)
+	return p
+}
+
+func TestBedrockStream(t *testing.T) {
+	srv := bedrockStandIn(t, bedrockTestModel,
+		converseEvent("messageStart", `{"p":"abcdefgh","role":"assistant"}`),
+		converseEvent("contentBlockDelta", `{"contentBlockIndex":0,"delta":{"text":"Let me read"},"p":"abcd"}`),
+		converseEvent("contentBlockDelta", `{"contentBlockIndex":0,"delta":{"text":" the file."},"p":"abcdefghijk"}`),
+		converseEvent("contentBlockStop", `{"contentBlockIndex":0,"p":"ab"}`),
+		converseEvent("contentBlockStart", `{"contentBlockIndex":1,"p":"abc","start":{"toolUse":{"name":"read_file","toolUseId":"tooluse_kZJMlvQmRJ6eAyJE5GIl7Q"}}}`),
+		converseEvent("contentBlockDelta", `{"contentBlockIndex":1,"delta":{"toolUse":{"input":"{\"path\": "}},"p":"abcdef"}`),
+		converseEvent("contentBlockDelta", `{"contentBlockIndex":1,"delta":{"toolUse":{"input":"\"main.go\"}"}},"p":"abcdefghi"}`),
+		converseEvent("contentBlockStop", `{"contentBlockIndex":1,"p":"abcdefg"}`),
+		converseEvent("messageStop", `{"p":"abcde","stopReason":"tool_use"}`),
+		converseEvent("metadata", `{"metrics":{"latencyMs":812},"p":"a","usage":{"cacheReadInputTokens":100,"inputTokens":312,"outputTokens":57,"totalTokens":469}}`),
+	)
+
+	var text bytes.Buffer
+	resp, err := newBedrockProvider(t, srv.URL, bedrockTestModel).SendMessage(context.Background(), Request{
+		Messages: []Message{TextMessage("user", "What is in main.go?")},
+	}, func(e Event) {
+		if e.Type == EventText {
+			text.WriteString(e.Text)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Content != "Let me read the file." || text.String() != resp.Content {
+		t.Errorf("content = %q, streamed %q", resp.Content, text.String())
+	}
+	if resp.StopReason != StopToolUse {
+		t.Errorf("stop reason = %q, want %q", resp.StopReason, StopToolUse)
+	}
+	if len(resp.ToolCalls) != 1 {
+		t.Fatalf("got %d tool calls, want 1", len(resp.ToolCalls))
+	}
+	call := resp.ToolCalls[0]
+	if call.ID != "tooluse_kZJMlvQmRJ6eAyJE5GIl7Q" || call.Name != "read_file" || call.Arguments != `{"path": "main.go"}` {
+		t.Errorf("tool call = %+v", call)
+	}
+	if want := (Usage{InputTokens: 412, OutputTokens: 57, CachedTokens: 100}); resp.Usage != want {
+		t.Errorf("usage = %+v, want %+v", resp.Usage, want)
+	}
+}
+
+func TestBedrockStreamException(t *testing.T) {
+	srv := bedrockStandIn(t, bedrockTestModel,
+		converseEvent("messageStart", `{"p":"abcdefgh","role":"assistant"}`),
+		eventMessage(map[string]string{
+			":exception-type": "throttlingException",
+			":content-type":   "application/json",
+			":message-type":   "exception",
+		}, `{"message":"Too many requests, please wait before trying again."}`),
+	)
+
+	_, err := newBedrockProvider(t, srv.URL, bedrockTestModel).SendMessage(context.Background(), Request{
+		Messages: []Message{TextMessage("user", "Hi")},
+	}, nil)
+	if !errors.Is(err, ErrRateLimit) {
+		t.Fatalf("got %v, want ErrRateLimit", err)
+	}
+	if !strings.Contains(err.Error(), "ThrottlingException: Too many requests") {
+		t.Errorf("error %q does not carry the exception", err)
+	}
+}
@@ -0,0 +1,226 @@
+package providers
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ModelInfo describes what a model accepts and what it costs.
+type ModelInfo struct {
+	Name     string `json:"name"`
+	Provider string `json:"provider"`
+	// ContextWindow is the number of tokens the model accepts, prompt and
+	// reply combined.
+	ContextWindow int `json:"context_window"`
+	// MaxOutput is the longest reply the model can produce, in tokens.
+	MaxOutput int `json:"max_output,omitempty"`
+	// Price is zero when the price is unknown.
+	Price        Price `json:"price"`
+	Tools        bool  `json:"tools"`
+	Vision       bool  `json:"vision"`
+	SystemPrompt bool  `json:"system_prompt"`
+	Temperature  bool  `json:"temperature"`
+	// Reasoning models can think before they answer, within a thinking
+	// budget or reasoning effort. OpenAI's take max_completion_tokens
+	// instead of max_tokens.
+	Reasoning bool `json:"reasoning,omitempty"`
+	// Known is false for models described only by the defaults of
+	// unknownModel, which are assumptions rather than facts. LookupModel
+	// sets it on catalog entries, and discovered models have it when the
+	// catalog or the provider's listing describes them.
+	Known bool `json:"known,omitempty"`
+}
+
+// catalog lists the built-in models of each provider, in the order they are
+// offered.
+var catalog = []ModelInfo{
+	{Name: "gpt-4.1", Provider: "openai", ContextWindow: 1047576, MaxOutput: 32768, Price: Price{Input: 2, Output: 8, CachedInput: 0.50}, Tools: true, Vision: true, SystemPrompt: true, Temperature: true},
+	{Name: "gpt-4.1-mini", Provider: "openai", ContextWindow: 1047576, MaxOutput: 32768, Price: Price{Input: 0.40, Output: 1.60, CachedInput: 0.10}, Tools: true, Vision: true, SystemPrompt: true, Temperature: true},
+	{Name: "gpt-4.1-nano", Provider: "openai", ContextWindow: 1047576, MaxOutput: 32768, Price: Price{Input: 0.10, Output: 0.40, CachedInput: 0.025}, Tools: true, Vision: true, SystemPrompt: true, Temperature: true},
+	{Name: "gpt-4.5-preview", Provider: "openai", ContextWindow: 128000, MaxOutput: 16384, Price: Price{Input: 75, Output: 150, CachedInput: 37.50}, Tools: true, Vision: true, SystemPrompt: true, Temperature: true},
+	{Name: "gpt-4o", Provider: "openai", ContextWindow: 128000, MaxOutput: 16384, Price: Price{Input: 2.50, Output: 10, CachedInput: 1.25}, Tools: true, Vision: true, SystemPrompt: true, Temperature: true},
+	{Name: "gpt-4o-mini", Provider: "openai", ContextWindow: 128000, MaxOutput: 16384, Price: Price{Input: 0.15, Output: 0.60, CachedInput: 0.075}, Tools: true, Vision: true, SystemPrompt: true, Temperature: true},
+	{Name: "gpt-4-turbo", Provider: "openai", ContextWindow: 128000, MaxOutput: 4096, Price: Price{Input: 10, Output: 30}, Tools: true, Vision: true, SystemPrompt: true, Temperature: true},
+	{Name: "gpt-4", Provider: "openai", ContextWindow: 8192, MaxOutput: 8192, Price: Price{Input: 30, Output: 60}, Tools: true, SystemPrompt: true, Temperature: true},
+	{Name: "gpt-3.5-turbo", Provider: "openai", ContextWindow: 16385, MaxOutput: 4096, Price: Price{Input: 0.50, Output: 1.50}, Tools: true, SystemPrompt: true, Temperature: true},
+	{Name: "o3", Provider: "openai", ContextWindow: 200000, MaxOutput: 100000, Price: Price{Input: 2, Output: 8, CachedInput: 0.50}, Tools: true, Vision: true, Reasoning: true},
+	{Name: "o4-mini", Provider: "openai", ContextWindow: 200000, MaxOutput: 100000, Price: Price{Input: 1.10, Output: 4.40, CachedInput: 0.275}, Tools: true, Vision: true, Reasoning: true},
+	{Name: "o3-mini", Provider: "openai", ContextWindow: 200000, MaxOutput: 100000, Price: Price{Input: 1.10, Output: 4.40, CachedInput: 0.55}, Tools: true, Reasoning: true},
+	{Name: "o1", Provider: "openai", ContextWindow: 200000, MaxOutput: 100000, Price: Price{Input: 15, Output: 60, CachedInput: 7.50}, Tools: true, Vision: true, Reasoning: true},
+	{Name: "o1-mini", Provider: "openai", ContextWindow: 128000, MaxOutput: 65536, Price: Price{Input: 3, Output: 12, CachedInput: 1.50}, Reasoning: true},
+	{Name: "o1-preview", Provider: "openai", ContextWindow: 128000, MaxOutput: 32768, Price: Price{Input: 15, Output: 60, CachedInput: 7.50}, Reasoning: true},
+
+	{Name: "claude-opus-4-20250514", Provider: "anthropic", ContextWindow: 200000, MaxOutput: 32000, Price: Price{Input: 15, Output: 75, CachedInput: 1.50}, Tools: true, Vision: true, SystemPrompt: true, Temperature: true, Reasoning: true},
+	{Name: "claude-sonnet-4-20250514", Provider: "anthropic", ContextWindow: 200000, MaxOutput: 64000, Price: Price{Input: 3, Output: 15, CachedInput: 0.30}, Tools: true, Vision: true, SystemPrompt: true, Temperature: true, Reasoning: true},
+	{Name: "claude-3-7-sonnet-20250219", Provider: "anthropic", ContextWindow: 200000, MaxOutput: 64000, Price: Price{Input: 3, Output: 15, CachedInput: 0.30}, Tools: true, Vision: true, SystemPrompt: true, Temperature: true, Reasoning: true},
+	{Name: "claude-3-5-sonnet-20241022", Provider: "anthropic", ContextWindow: 200000, MaxOutput: 8192, Price: Price{Input: 3, Output: 15, CachedInput: 0.30}, Tools: true, Vision: true, SystemPrompt: true, Temperature: true},
+	{Name: "claude-3-5-sonnet-20240620", Provider: "anthropic", ContextWindow: 200000, MaxOutput: 8192, Price: Price{Input: 3, Output: 15, CachedInput: 0.30}, Tools: true, Vision: true, SystemPrompt: true, Temperature: true},
+	{Name: "claude-3-5-haiku-20241022", Provider: "anthropic", ContextWindow: 200000, MaxOutput: 8192, Price: Price{Input: 0.80, Output: 4, CachedInput: 0.08}, Tools: true, SystemPrompt: true, Temperature: true},
+	{Name: "claude-3-opus-20240229", Provider: "anthropic", ContextWindow: 200000, MaxOutput: 4096, Price: Price{Input: 15, Output: 75, CachedInput: 1.50}, Tools: true, Vision: true, SystemPrompt: true, Temperature: true},
+	{Name: "claude-3-haiku-20240307", Provider: "anthropic", ContextWindow: 200000, MaxOutput: 4096, Price: Price{Input: 0.25, Output: 1.25, CachedInput: 0.03}, Tools: true, Vision: true, SystemPrompt: true, Temperature: true},
+
+	{Name: "gemini-2.5-pro", Provider: "google", ContextWindow: 1048576, MaxOutput: 65536, Price: Price{Input: 1.25, Output: 10, CachedInput: 0.31}, Tools: true, Vision: true, SystemPrompt: true, Temperature: true, Reasoning: true},
+	{Name: "gemini-2.5-flash", Provider: "google", ContextWindow: 1048576, MaxOutput: 65536, Price: Price{Input: 0.30, Output: 2.50, CachedInput: 0.075}, Tools: true, Vision: true, SystemPrompt: true, Temperature: true, Reasoning: true},
+	{Name: "gemini-2.0-flash", Provider: "google", ContextWindow: 1048576, MaxOutput: 8192, Price: Price{Input: 0.10, Output: 0.40, CachedInput: 0.025}, Tools: true, Vision: true, SystemPrompt: true, Temperature: true},
+	{Name: "gemini-1.5-pro", Provider: "google", ContextWindow: 2097152, MaxOutput: 8192, Price: Price{Input: 1.25, Output: 5, CachedInput: 0.3125}, Tools: true, Vision: true, SystemPrompt: true, Temperature: true},
+	{Name: "gemini-1.5-flash", Provider: "google", ContextWindow: 1048576, MaxOutput: 8192, Price: Price{Input: 0.075, Output: 0.30, CachedInput: 0.01875}, Tools: true, Vision: true, SystemPrompt: true, Temperature: true},
+	{Name: "gemini-1.0-pro", Provider: "google", ContextWindow: 32760, MaxOutput: 8192, Price: Price{Input: 0.50, Output: 1.50}, Tools: true, Temperature: true},
+
+	{Name: "openai/gpt-4o", Provider: "openrouter", ContextWindow: 128000, MaxOutput: 16384, Price: Price{Input: 2.50, Output: 10}, Tools: true, Vision: true, SystemPrompt: true, Temperature: true},
+	{Name: "openai/gpt-4", Provider: "openrouter", ContextWindow: 8192, MaxOutput: 8192, Price: Price{Input: 30, Output: 60}, Tools: true, SystemPrompt: true, Temperature: true},
+	{Name: "anthropic/claude-3.5-sonnet", Provider: "openrouter", ContextWindow: 200000, MaxOutput: 8192, Price: Price{Input: 3, Output: 15}, Tools: true, Vision: true, SystemPrompt: true, Temperature: true},
+	{Name: "google/gemini-pro-1.5", Provider: "openrouter", ContextWindow: 2097152, MaxOutput: 8192, Price: Price{Input: 1.25, Output: 5}, Tools: true, Vision: true, SystemPrompt: true, Temperature: true},
+	{Name: "meta-llama/llama-3.1-70b-instruct", Provider: "openrouter", ContextWindow: 131072, MaxOutput: 4096, Price: Price{Input: 0.12, Output: 0.30}, Tools: true, SystemPrompt: true, Temperature: true},
+
+	{Name: "nvidia/llama-3.1-nemotron-70b-instruct", Provider: "nvidia", ContextWindow: 131072, MaxOutput: 4096, Tools: true, SystemPrompt: true, Temperature: true},
+	{Name: "nvidia/mixtral-8x7b-instruct-v0.1", Provider: "nvidia", ContextWindow: 32768, MaxOutput: 4096, SystemPrompt: true, Temperature: true},
+	{Name: "nvidia/mistral-7b-instruct-v0.2", Provider: "nvidia", ContextWindow: 32768, MaxOutput: 4096, SystemPrompt: true, Temperature: true},
+
+	{Name: "anthropic.claude-3-5-sonnet-20240620-v1:0", Provider: "bedrock", ContextWindow: 200000, MaxOutput: 8192, Price: Price{Input: 3, Output: 15}, Tools: true, Vision: true, SystemPrompt: true, Temperature: true},
+	{Name: "anthropic.claude-3-haiku-20240307-v1:0", Provider: "bedrock", ContextWindow: 200000, MaxOutput: 4096, Price: Price{Input: 0.25, Output: 1.25}, Tools: true, Vision: true, SystemPrompt: true, Temperature: true},
+	// Bedrock does not stream tool use for Llama models.
+	{Name: "meta.llama3-1-70b-instruct-v1:0", Provider: "bedrock", ContextWindow: 128000, MaxOutput: 2048, Price: Price{Input: 0.72, Output: 0.72}, SystemPrompt: true, Temperature: true},
+	{Name: "meta.llama3-1-8b-instruct-v1:0", Provider: "bedrock", ContextWindow: 128000, MaxOutput: 2048, Price: Price{Input: 0.22, Output: 0.22}, SystemPrompt: true, Temperature: true},
+}
+
+// unknownModel is assumed for models missing from the catalog, such as the
+// ones served by custom providers: a small context window and no limits on
+// what the request may contain.
+var unknownModel = ModelInfo{
+	ContextWindow: 8192,
+	Tools:         true,
+	SystemPrompt:  true,
+	Temperature:   true,
+}
+
+// dateSuffix matches the snapshot suffix at the end of model names such as
+// "claude-3-5-sonnet-20241022", "gpt-4o-2024-08-06" or "gemini-1.5-pro-latest".
+var dateSuffix = regexp.MustCompile(`-(\d{4}-\d{2}-\d{2}|\d{8}|latest)$`)
+
+// LookupModel returns the catalog entry for the model, or the description of
+// a discovered one. Names that are not listed match the catalog entry of the
+// same family, differing only in the snapshot suffix, so "gpt-4o-2024-08-06"
+// is described by "gpt-4o" and "claude-3-5-sonnet-latest" by
+// "claude-3-5-sonnet-20241022", but "gpt-4.1" is not described by "gpt-4".
+// ok is false if nothing matches, in which case permissive defaults are
+// returned.
+func LookupModel(name string) (info ModelInfo, ok bool) {
+	for _, m := range catalog {
+		if m.Name == name {
+			m.Known = true
+			return m, true
+		}
+	}
+	if m, ok := lookupDiscovered(name); ok {
+		return m, m.Known
+	}
+
+	// The catalog lists the newest snapshot of a family first.
+	for _, m := range catalog {
+		if family(m.Name) == family(name) {
+			info = m
+			info.Name = name
+			info.Known = true
+			return info, true
+		}
+	}
+	info = unknownModel
+	info.Name = name
+	return info, false
+}
+
+func family(name string) string {
+	return dateSuffix.ReplaceAllString(name, "")
+}
+
+// catalogModels lists the names of the provider's models in the catalog,
+// followed by the ones discovered from its API.
+func catalogModels(provider string) []string {
+	var names []string
+	for _, m := range catalog {
+		if m.Provider == provider {
+			names = append(names, m.Name)
+		}
+	}
+	return withDiscovered(provider, names)
+}
+
+// Summary describes the model in one line, e.g. "128k context, 16k output,
+// $2.50/$10.00 per 1M tokens, tools, vision".
+func (m ModelInfo) Summary() string {
+	parts := []string{
+		fmt.Sprintf("%s context", formatTokenCount(m.ContextWindow)),
+	}
+	if m.MaxOutput > 0 {
+		parts = append(parts, fmt.Sprintf("%s output", formatTokenCount(m.MaxOutput)))
+	}
+	if m.Price != (Price{}) {
+		parts = append(parts, fmt.Sprintf("$%.2f/$%.2f per 1M tokens", m.Price.Input, m.Price.Output))
+	}
+	if m.Tools {
+		parts = append(parts, "tools")
+	}
+	if m.Vision {
+		parts = append(parts, "vision")
+	}
+	if m.Reasoning {
+		parts = append(parts, "reasoning")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// checkThinking returns an error if the thinking budget leaves the model no
+// room to answer within the most it can produce.
+func (m ModelInfo) checkThinking(gen GenerationConfig) error {
+	if m.MaxOutput > 0 && gen.ThinkingBudget >= m.MaxOutput {
+		return fmt.Errorf("thinking budget must be below the %d output tokens %s can produce, got %d", m.MaxOutput, m.Name, gen.ThinkingBudget)
+	}
+	return nil
+}
+
+func formatTokenCount(n int) string {
+	switch {
+	case n >= 1000000:
+		return strconv.FormatFloat(math.Round(float64(n)/100000)/10, 'f', -1, 64) + "M"
+	case n >= 1000:
+		return fmt.Sprintf("%dk", n/1000)
+	}
+	return strconv.Itoa(n)
+}
+
+// adapt removes what the model would reject from a request: tools for models
+// without tool support, sampling settings for models with fixed sampling,
+// reasoning settings for known models that do not reason, and system
+// messages, which are sent as user messages instead. The reply limit is
+// lowered to what the model can produce.
+func (m ModelInfo) adapt(req Request, gen GenerationConfig) (Request, GenerationConfig) {
+	if !m.Tools {
+		req.Tools = nil
+	}
+	if !m.Temperature {
+		gen.Temperature = nil
+		gen.TopP = nil
+	}
+	if m.Known && !m.Reasoning {
+		gen.ThinkingBudget = 0
+		gen.ReasoningEffort = ""
+	}
+	if m.MaxOutput > 0 && gen.MaxTokens > m.MaxOutput {
+		gen.MaxTokens = m.MaxOutput
+	}
+	gen.outputLimit = m.MaxOutput
+	if !m.SystemPrompt {
+		messages := make([]Message, len(req.Messages))
+		for i, msg := range req.Messages {
+			if msg.Role == "system" {
+				msg.Role = "user"
+			}
+			messages[i] = msg
+		}
+		req.Messages = messages
+	}
+	return req, gen
+}
@@ -0,0 +1,37 @@
+package providers
+
+import "testing"
+
+func TestAdaptDropsReasoningForModelsThatDoNotReason(t *testing.T) {
+	gen := GenerationConfig{ThinkingBudget: 2048, ReasoningEffort: "high"}
+
+	for _, name := range []string{"claude-3-5-sonnet-20241022", "gpt-4o"} {
+		info, _ := LookupModel(name)
+		if _, got := info.adapt(Request{}, gen); got.ThinkingBudget != 0 || got.ReasoningEffort != "" {
+			t.Errorf("%s: kept thinking budget %d and reasoning effort %q", name, got.ThinkingBudget, got.ReasoningEffort)
+		}
+	}
+
+	// Nothing is known about a model missing from the catalog, so it
+	// may well reason.
+	info, _ := LookupModel("acme/unlisted-reasoner")
+	if _, got := info.adapt(Request{}, gen); got.ThinkingBudget != 2048 || got.ReasoningEffort != "high" {
+		t.Errorf("dropped the reasoning settings of an unknown model: %+v", got)
+	}
+}
+
+func TestThinkingBudgetStaysWithinOutputLimit(t *testing.T) {
+	info, _ := LookupModel("claude-opus-4-20250514")
+	anthropic, _ := Lookup("anthropic")
+
+	_, gen := info.adapt(Request{}, GenerationConfig{ThinkingBudget: 30000})
+	body := anthropic.BuildRequest(info.Name, Request{}, gen)
+	if body["max_tokens"] != info.MaxOutput {
+		t.Errorf("max_tokens = %v, want the model's limit of %d", body["max_tokens"], info.MaxOutput)
+	}
+
+	_, gen = info.adapt(Request{}, GenerationConfig{ThinkingBudget: 32000})
+	if err := info.checkThinking(gen); err == nil {
+		t.Error("accepted a thinking budget that leaves no room for the answer")
+	}
+}
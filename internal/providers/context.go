@@ -0,0 +1,65 @@
+package providers
+
+// ContextWindow returns the number of tokens the model accepts, prompt and
+// reply combined.
+func ContextWindow(model string) int {
+	info, _ := LookupModel(model)
+	return info.ContextWindow
+}
+
+// EstimateTokens gives a rough token count for the messages, at about four
+// characters per token plus a small overhead for each message.
+func EstimateTokens(messages []Message) int {
+	total := 0
+	for _, m := range messages {
+		chars, images := 0, 0
+		for _, b := range m.Content {
+			switch b.Type {
+			case BlockImage:
+				images++
+			case BlockToolCall:
+				chars += len(b.ToolCall.Name) + len(b.ToolCall.Arguments)
+			case BlockToolResult:
+				chars += len(b.ToolResult.Content)
+			default:
+				chars += len(b.Text)
+			}
+		}
+		total += chars/4 + 4 + images*imageTokens
+	}
+	return total
+}
+
+// TrimMessages drops the oldest turns until the messages fit in maxTokens.
+// Leading system messages are always kept, and turns are removed whole,
+// starting at a user message, so tool calls are never separated from their
+// results. The last turn is kept even if it alone is too long.
+func TrimMessages(messages []Message, maxTokens int) []Message {
+	var system []Message
+	rest := messages
+	for len(rest) > 0 && rest[0].Role == "system" {
+		system = append(system, rest[0])
+		rest = rest[1:]
+	}
+
+	start := 0
+	for EstimateTokens(system)+EstimateTokens(rest[start:]) > maxTokens {
+		next := nextTurn(rest, start)
+		if next < 0 {
+			break
+		}
+		start = next
+	}
+
+	return append(system, rest[start:]...)
+}
+
+// nextTurn returns the index of the first user message after i, or -1.
+func nextTurn(messages []Message, i int) int {
+	for j := i + 1; j < len(messages); j++ {
+		if messages[j].Role == "user" {
+			return j
+		}
+	}
+	return -1
+}
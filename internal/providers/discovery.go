@@ -0,0 +1,129 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+var (
+	discoveredMu sync.RWMutex
+	discovered   = make(map[string][]ModelInfo)
+)
+
+// SetDiscoveredModels records the models a provider reported serving, so
+// they are offered and described alongside the catalog's.
+func SetDiscoveredModels(provider string, models []ModelInfo) {
+	discoveredMu.Lock()
+	defer discoveredMu.Unlock()
+	discovered[provider] = models
+}
+
+// lookupDiscovered returns the discovered model with the exact name.
+func lookupDiscovered(name string) (ModelInfo, bool) {
+	discoveredMu.RLock()
+	defer discoveredMu.RUnlock()
+	for _, models := range discovered {
+		for _, m := range models {
+			if m.Name == name {
+				return m, true
+			}
+		}
+	}
+	return ModelInfo{}, false
+}
+
+// withDiscovered appends the models discovered for the provider that are not
+// in names already.
+func withDiscovered(provider string, names []string) []string {
+	discoveredMu.RLock()
+	defer discoveredMu.RUnlock()
+
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		seen[name] = true
+	}
+	result := append([]string{}, names...)
+	for _, m := range discovered[provider] {
+		if !seen[m.Name] {
+			result = append(result, m.Name)
+		}
+	}
+	return result
+}
+
+// ListModels asks the provider which models it serves. Models the catalog
+// knows keep its description, updated with whatever the provider reports.
+func (p *SimpleProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", p.adapter.ModelsEndpoint(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.authorize(httpReq, nil); err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, newStatusError(resp)
+	}
+
+	found, err := p.adapter.DecodeModels(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	models := make([]ModelInfo, 0, len(found))
+	for _, f := range found {
+		models = append(models, mergeModel(p.Name(), f))
+	}
+	return models, nil
+}
+
+// mergeModel fills in what the provider did not report about a model from
+// the catalog entry of its family. A model the catalog does not know keeps
+// the capabilities the listing gave it, such as an Azure deployment named
+// apart from the model it serves, and stays unknown if the listing did not
+// describe it either.
+func mergeModel(provider string, found ModelInfo) ModelInfo {
+	info, ok := LookupModel(found.Name)
+	if !ok && found.Known {
+		info = found
+		if info.ContextWindow == 0 {
+			info.ContextWindow = unknownModel.ContextWindow
+		}
+	}
+	info.Known = ok || found.Known
+	info.Name = found.Name
+	info.Provider = provider
+	if found.ContextWindow > 0 {
+		info.ContextWindow = found.ContextWindow
+	}
+	if found.MaxOutput > 0 {
+		info.MaxOutput = found.MaxOutput
+	}
+	if found.Price != (Price{}) {
+		info.Price = found.Price
+	}
+	if found.Vision {
+		info.Vision = true
+	}
+	return info
+}
+
+// listedModel returns the description of a model that a listing reports
+// the vision of: the capabilities assumed for unknown models, without their
+// limits, to be completed by the caller.
+func listedModel(name string) ModelInfo {
+	info := unknownModel
+	info.Name = name
+	info.ContextWindow = 0
+	info.Known = true
+	return info
+}
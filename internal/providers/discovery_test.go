@@ -0,0 +1,26 @@
+package providers
+
+import "testing"
+
+func TestDiscoveredModelsKeepUnknownVision(t *testing.T) {
+	t.Cleanup(func() { SetDiscoveredModels("openai", nil) })
+
+	SetDiscoveredModels("openai", []ModelInfo{
+		mergeModel("openai", ModelInfo{Name: "gpt-99"}),
+		mergeModel("openai", ModelInfo{Name: "gpt-4o-2099-01-01"}),
+	})
+	if err := CheckVision("gpt-99"); err != nil {
+		t.Errorf("rejected images for a model the listing did not describe: %v", err)
+	}
+	if info, ok := LookupModel("gpt-4o-2099-01-01"); !ok || !info.Vision {
+		t.Errorf("lost the catalog's description of a discovered snapshot: %+v, %v", info, ok)
+	}
+
+	SetDiscoveredModels("openrouter", []ModelInfo{
+		mergeModel("openrouter", ModelInfo{Name: "acme/text-only", Known: true}),
+	})
+	t.Cleanup(func() { SetDiscoveredModels("openrouter", nil) })
+	if err := CheckVision("acme/text-only"); err == nil {
+		t.Error("accepted images for a model listed without image input")
+	}
+}
@@ -0,0 +1,284 @@
+package providers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The kinds of failure a provider reports. A StatusError matches the one it
+// was classified as with errors.Is.
+var (
+	ErrNoAPIKey        = errors.New("API key not set")
+	ErrAuth            = errors.New("authentication failed")
+	ErrRateLimit       = errors.New("rate limited")
+	ErrQuota           = errors.New("quota exceeded")
+	ErrContextLength   = errors.New("context length exceeded")
+	ErrModelNotFound   = errors.New("model not found")
+	ErrContentFiltered = errors.New("content filtered")
+	ErrOverloaded      = errors.New("server overloaded")
+)
+
+// StatusError is returned when the API answers with a non-200 status.
+type StatusError struct {
+	StatusCode int
+	Body       string
+	// Kind is one of the errors above, or nil if the failure is of no
+	// particular kind.
+	Kind error
+	// Message is the explanation from the provider's error object, if the
+	// body had one.
+	Message string
+	// RetryAfter is how long the provider asked us to wait, if it did.
+	RetryAfter time.Duration
+	// ResetAfter is how long until the exhausted rate limit resets, going
+	// by the rate limit headers. Retries wait at least this long, up to
+	// the policy's MaxDelay.
+	ResetAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	message := e.Message
+	if message == "" {
+		message = e.Body
+	}
+	if e.Kind != nil {
+		return fmt.Sprintf("%v (status %d): %s", e.Kind, e.StatusCode, message)
+	}
+	return fmt.Sprintf("API error (status %d): %s", e.StatusCode, message)
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Kind
+}
+
+func newStatusError(resp *http.Response) *StatusError {
+	body, _ := io.ReadAll(resp.Body)
+	err := &StatusError{
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+		RetryAfter: retryAfter(resp.Header, time.Now()),
+	}
+	err.Kind, err.Message = classifyError(resp.StatusCode, body)
+	// Bedrock names the exception in a header rather than the body, as
+	// in "ThrottlingException:http://internal.amazon.com/coral/...".
+	if errorType, _, _ := strings.Cut(resp.Header.Get("X-Amzn-ErrorType"), ":"); errorType != "" {
+		if kind, ok := errorCodes[errorType]; ok {
+			err.Kind = kind
+		}
+	}
+	// Rate limit headers come with every response, but they only say
+	// when to try again if the limit is what made the request fail.
+	if resp.StatusCode == http.StatusTooManyRequests {
+		err.ResetAfter = rateLimitReset(resp.Header, time.Now())
+	}
+	return err
+}
+
+// errorCodes maps the error types and codes the providers send to the kind
+// of failure they mean. OpenAI sends them as error.code or error.type,
+// Anthropic as error.type, Gemini as error.status or a detail's reason,
+// Azure as error.code or error.innererror.code and Bedrock as the exception
+// named in the x-amzn-ErrorType header or the stream.
+var errorCodes = map[string]error{
+	"invalid_api_key":      ErrAuth,
+	"authentication_error": ErrAuth,
+	"permission_error":     ErrAuth,
+	"UNAUTHENTICATED":      ErrAuth,
+	"PERMISSION_DENIED":    ErrAuth,
+	"API_KEY_INVALID":      ErrAuth,
+
+	"AccessDeniedException":       ErrAuth,
+	"UnrecognizedClientException": ErrAuth,
+
+	"rate_limit_exceeded": ErrRateLimit,
+	"rate_limit_error":    ErrRateLimit,
+	"RESOURCE_EXHAUSTED":  ErrRateLimit,
+	"ThrottlingException": ErrRateLimit,
+
+	"insufficient_quota":            ErrQuota,
+	"billing_hard_limit_reached":    ErrQuota,
+	"billing_not_active":            ErrQuota,
+	"ServiceQuotaExceededException": ErrQuota,
+
+	"context_length_exceeded": ErrContextLength,
+	"string_above_max_length": ErrContextLength,
+	"request_too_large":       ErrContextLength,
+
+	"model_not_found":    ErrModelNotFound,
+	"not_found_error":    ErrModelNotFound,
+	"NOT_FOUND":          ErrModelNotFound,
+	"DeploymentNotFound": ErrModelNotFound,
+
+	"ResourceNotFoundException": ErrModelNotFound,
+
+	"content_filter":               ErrContentFiltered,
+	"content_policy_violation":     ErrContentFiltered,
+	"ResponsibleAIPolicyViolation": ErrContentFiltered,
+
+	"overloaded_error": ErrOverloaded,
+	"UNAVAILABLE":      ErrOverloaded,
+
+	"ServiceUnavailableException": ErrOverloaded,
+	"ModelNotReadyException":      ErrOverloaded,
+}
+
+// contextLengthPhrases appear in the messages of context length errors that
+// come as generic invalid request errors.
+var contextLengthPhrases = []string{
+	"prompt is too long",
+	"maximum context length",
+	"context length",
+	"context window",
+	"exceeds the maximum number of tokens",
+	"input token count",
+	"input is too long",
+}
+
+// quotaPhrases appear in the messages of errors about an account out of
+// credit that come as generic invalid request or rate limit errors.
+var quotaPhrases = []string{
+	"credit balance is too low",
+	"insufficient credits",
+}
+
+// classifyError works out the kind of failure from the error object in the
+// body, falling back to the status code, and returns the provider's message.
+func classifyError(status int, body []byte) (kind error, message string) {
+	var parsed struct {
+		Error struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+			// Code is a number for some providers, and Status is one
+			// for Azure.
+			Code    json.RawMessage `json:"code"`
+			Status  json.RawMessage `json:"status"`
+			Details []struct {
+				Reason string `json:"reason"`
+			} `json:"details"`
+			InnerError struct {
+				Code string `json:"code"`
+				// ContentFilterResult says which of Azure's filter
+				// categories caught the content.
+				ContentFilterResult map[string]struct {
+					Filtered bool `json:"filtered"`
+				} `json:"content_filter_result"`
+			} `json:"innererror"`
+		} `json:"error"`
+		// Message is where Bedrock puts its explanation.
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &parsed) == nil {
+		e := parsed.Error
+		message = e.Message
+		if message == "" {
+			message = parsed.Message
+		}
+
+		var filtered []string
+		for category, result := range e.InnerError.ContentFilterResult {
+			if result.Filtered {
+				filtered = append(filtered, category)
+			}
+		}
+		if len(filtered) > 0 {
+			sort.Strings(filtered)
+			message += fmt.Sprintf(" (filtered: %s)", strings.Join(filtered, ", "))
+		}
+
+		var code, errStatus string
+		json.Unmarshal(e.Code, &code)
+		json.Unmarshal(e.Status, &errStatus)
+		codes := []string{code, e.Type, errStatus, e.InnerError.Code}
+		for _, d := range e.Details {
+			codes = append(codes, d.Reason)
+		}
+		for _, c := range codes {
+			if kind, ok := errorCodes[c]; ok {
+				return kind, message
+			}
+		}
+
+		lower := strings.ToLower(message)
+		for _, phrase := range quotaPhrases {
+			if strings.Contains(lower, phrase) {
+				return ErrQuota, message
+			}
+		}
+		for _, phrase := range contextLengthPhrases {
+			if strings.Contains(lower, phrase) {
+				return ErrContextLength, message
+			}
+		}
+	}
+
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrAuth, message
+	case http.StatusPaymentRequired:
+		return ErrQuota, message
+	case http.StatusNotFound:
+		return ErrModelNotFound, message
+	case http.StatusRequestEntityTooLarge:
+		return ErrContextLength, message
+	case http.StatusTooManyRequests:
+		return ErrRateLimit, message
+	case http.StatusServiceUnavailable, 529:
+		return ErrOverloaded, message
+	}
+	return nil, message
+}
+
+// StreamError is a failure the provider reported inside a stream that had
+// already started, either as an error event or as a reason for stopping
+// that leaves the reply unusable.
+type StreamError struct {
+	Kind    error
+	Message string
+}
+
+func (e *StreamError) Error() string {
+	if e.Kind != nil {
+		return fmt.Sprintf("%v: %s", e.Kind, e.Message)
+	}
+	return "stream error: " + e.Message
+}
+
+func (e *StreamError) Unwrap() error {
+	return e.Kind
+}
+
+// errIncompleteStream is returned when a stream ends before the provider
+// said why the model stopped, which means the connection was cut.
+var errIncompleteStream = fmt.Errorf("stream ended before the reply was complete: %w", io.ErrUnexpectedEOF)
+
+// decodeStreamError returns the error carried by a stream event, or nil if
+// the event is not an error. All the providers wrap it in an "error" object
+// like the one in their error responses.
+func decodeStreamError(data []byte) error {
+	var probe struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(data, &probe) != nil || len(probe.Error) == 0 || string(probe.Error) == "null" {
+		return nil
+	}
+
+	kind, message := classifyError(0, data)
+	if message == "" {
+		message = string(probe.Error)
+	}
+	return &StreamError{Kind: kind, Message: message}
+}
+
+// filteredError reports a reply the provider stopped with a content filter.
+func filteredError(reason string) error {
+	return &StreamError{
+		Kind:    ErrContentFiltered,
+		Message: fmt.Sprintf("the reply was stopped (%s)", reason),
+	}
+}
@@ -0,0 +1,126 @@
+package providers
+
+import (
+	"context"
+	"sync"
+)
+
+// EventType says what an Event carries.
+type EventType int
+
+const (
+	// EventText carries a piece of the answer in Text.
+	EventText EventType = iota
+	// EventThinking carries a piece of the model's reasoning in Text.
+	EventThinking
+	// EventToolCall carries a piece of a tool call in ToolCall.
+	EventToolCall
+	// EventUsage carries the token counts of the request in Usage.
+	EventUsage
+	// EventStop carries why the model stopped in StopReason. It is the
+	// last event of a request that succeeded.
+	EventStop
+	// EventError carries the error that ended the request in Err. Only a
+	// Stream delivers it; SendMessage returns the error instead.
+	EventError
+)
+
+// Event is something that happened while the reply streamed.
+type Event struct {
+	Type     EventType
+	Text     string
+	ToolCall ToolCallDelta
+	Usage    Usage
+	// StopReason is one of the Stop constants, or the provider's own
+	// reason if none of them fits.
+	StopReason string
+	Err        error
+}
+
+// ToolCallDelta is a piece of a tool call as it streams. Deltas with the same
+// Index belong to the same call: the first one has its ID and Name, and the
+// Arguments of all of them joined make up the call's arguments.
+type ToolCallDelta struct {
+	Index     int
+	ID        string
+	Name      string
+	Arguments string
+}
+
+// EventHandler receives the events of a request as they arrive.
+type EventHandler func(Event)
+
+// Stream is a request whose events are read as they arrive, either from the
+// Events channel or one at a time with Next.
+type Stream struct {
+	events    chan Event
+	event     Event
+	cancel    context.CancelFunc
+	closed    chan struct{}
+	closeOnce sync.Once
+	resp      *Response
+	err       error
+}
+
+// StreamMessage sends the request on another goroutine and returns its
+// events. Cancelling ctx stops the request, and the stream ends with an
+// EventError. The stream must be read to the end or closed.
+func StreamMessage(ctx context.Context, p Provider, req Request) *Stream {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Stream{
+		events: make(chan Event),
+		cancel: cancel,
+		closed: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(s.events)
+		defer cancel()
+
+		send := func(e Event) {
+			select {
+			case s.events <- e:
+			case <-s.closed:
+			}
+		}
+		s.resp, s.err = p.SendMessage(ctx, req, send)
+		if s.err != nil {
+			send(Event{Type: EventError, Err: s.err})
+		}
+	}()
+
+	return s
+}
+
+// Events returns the channel the events arrive on. It is closed after the
+// last one.
+func (s *Stream) Events() <-chan Event {
+	return s.events
+}
+
+// Next waits for the next event, which Event then returns, and reports
+// whether there was one.
+func (s *Stream) Next() bool {
+	e, ok := <-s.events
+	s.event = e
+	return ok
+}
+
+// Event returns the event read by the last call to Next.
+func (s *Stream) Event() Event {
+	return s.event
+}
+
+// Response waits for the request to finish, discarding the events not read
+// yet, and returns the complete reply or the error that ended it.
+func (s *Stream) Response() (*Response, error) {
+	for range s.events {
+	}
+	return s.resp, s.err
+}
+
+// Close stops the request if it is still running and discards its events.
+func (s *Stream) Close() {
+	s.cancel()
+	s.closeOnce.Do(func() { close(s.closed) })
+}
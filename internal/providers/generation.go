@@ -0,0 +1,202 @@
+package providers
+
+import (
+	"fmt"
+	"sort"
+)
+
+// GenerationConfig holds the sampling settings sent with each request.
+// Pointer fields are left out of the request when nil, so the provider's own
+// default applies.
+type GenerationConfig struct {
+	Temperature *float64
+	MaxTokens   int
+	TopP        *float64
+	Stop        []string
+	Seed        *int
+	// ThinkingBudget is how many tokens the model may spend reasoning
+	// before it answers, for Anthropic, Gemini and OpenRouter. 0 leaves
+	// thinking off.
+	ThinkingBudget int
+	// ReasoningEffort is "low", "medium" or "high" for OpenAI reasoning
+	// models and OpenRouter.
+	ReasoningEffort string
+	// SafetySettings maps Gemini harm categories, such as
+	// HARM_CATEGORY_HARASSMENT, to the threshold at which replies are
+	// blocked, such as BLOCK_ONLY_HIGH.
+	SafetySettings map[string]string
+
+	// outputLimit is the most the model can produce, set by adapt when
+	// the catalog knows it, so raising the reply limit to fit the
+	// thinking budget does not go past it.
+	outputLimit int
+}
+
+// safetyThresholds are the thresholds Gemini accepts in safety settings.
+var safetyThresholds = map[string]bool{
+	"BLOCK_NONE":             true,
+	"BLOCK_ONLY_HIGH":        true,
+	"BLOCK_MEDIUM_AND_ABOVE": true,
+	"BLOCK_LOW_AND_ABOVE":    true,
+	"OFF":                    true,
+}
+
+// DefaultMaxTokens is used where a provider requires a reply limit and none
+// is configured.
+const DefaultMaxTokens = 4096
+
+// Validate checks the settings against the ranges the provider accepts.
+func (g GenerationConfig) Validate(provider string) error {
+	limits := limitsFor(provider)
+
+	if g.Temperature != nil && (*g.Temperature < 0 || *g.Temperature > limits.MaxTemperature) {
+		return fmt.Errorf("temperature must be between 0 and %g for %s, got %g", limits.MaxTemperature, provider, *g.Temperature)
+	}
+	if g.MaxTokens < 0 {
+		return fmt.Errorf("max tokens must be positive, got %d", g.MaxTokens)
+	}
+	if g.TopP != nil && (*g.TopP < 0 || *g.TopP > 1) {
+		return fmt.Errorf("top_p must be between 0 and 1, got %g", *g.TopP)
+	}
+	if limits.MaxStop > 0 && len(g.Stop) > limits.MaxStop {
+		return fmt.Errorf("%s accepts at most %d stop sequences, got %d", provider, limits.MaxStop, len(g.Stop))
+	}
+	if g.ThinkingBudget < 0 || (g.ThinkingBudget > 0 && g.ThinkingBudget < limits.MinThinkingBudget) {
+		return fmt.Errorf("thinking budget must be at least %d tokens for %s, got %d", limits.MinThinkingBudget, provider, g.ThinkingBudget)
+	}
+	switch g.ReasoningEffort {
+	case "", "low", "medium", "high":
+	default:
+		return fmt.Errorf("reasoning effort must be low, medium or high, got %q", g.ReasoningEffort)
+	}
+	for category, threshold := range g.SafetySettings {
+		if !safetyThresholds[threshold] {
+			return fmt.Errorf("unknown safety threshold %q for %s", threshold, category)
+		}
+	}
+	return nil
+}
+
+// maxTokens returns the configured reply limit or the default.
+func (g GenerationConfig) maxTokens() int {
+	if g.MaxTokens > 0 {
+		return g.MaxTokens
+	}
+	return DefaultMaxTokens
+}
+
+// applyOpenAI adds the settings to a chat completions request body.
+func (g GenerationConfig) applyOpenAI(body map[string]interface{}) {
+	if g.Temperature != nil {
+		body["temperature"] = *g.Temperature
+	}
+	if g.MaxTokens > 0 {
+		body["max_tokens"] = g.MaxTokens
+	}
+	if g.TopP != nil {
+		body["top_p"] = *g.TopP
+	}
+	if len(g.Stop) > 0 {
+		body["stop"] = g.Stop
+	}
+	if g.Seed != nil {
+		body["seed"] = *g.Seed
+	}
+	if g.ReasoningEffort != "" {
+		body["reasoning_effort"] = g.ReasoningEffort
+	}
+}
+
+// applyAnthropic adds the settings to a messages request body. The API has
+// no seed parameter, so it is not sent. With thinking on, the sampling
+// settings cannot be changed and the reply limit has to leave room for the
+// thinking budget.
+func (g GenerationConfig) applyAnthropic(body map[string]interface{}) {
+	body["max_tokens"] = g.maxTokens()
+	if g.ThinkingBudget > 0 {
+		body["thinking"] = map[string]interface{}{
+			"type":          "enabled",
+			"budget_tokens": g.ThinkingBudget,
+		}
+		if g.maxTokens() <= g.ThinkingBudget {
+			limit := g.ThinkingBudget + g.maxTokens()
+			if g.outputLimit > 0 && limit > g.outputLimit {
+				limit = g.outputLimit
+			}
+			body["max_tokens"] = limit
+		}
+	} else {
+		if g.Temperature != nil {
+			body["temperature"] = *g.Temperature
+		}
+		if g.TopP != nil {
+			body["top_p"] = *g.TopP
+		}
+	}
+	if len(g.Stop) > 0 {
+		body["stop_sequences"] = g.Stop
+	}
+}
+
+// googleConfig returns the generationConfig object of a Gemini request.
+func (g GenerationConfig) googleConfig() map[string]interface{} {
+	config := map[string]interface{}{
+		"maxOutputTokens": g.maxTokens(),
+	}
+	if g.Temperature != nil {
+		config["temperature"] = *g.Temperature
+	}
+	if g.TopP != nil {
+		config["topP"] = *g.TopP
+	}
+	if len(g.Stop) > 0 {
+		config["stopSequences"] = g.Stop
+	}
+	if g.Seed != nil {
+		config["seed"] = *g.Seed
+	}
+	if g.ThinkingBudget > 0 {
+		config["thinkingConfig"] = map[string]interface{}{
+			"thinkingBudget":  g.ThinkingBudget,
+			"includeThoughts": true,
+		}
+	}
+	return config
+}
+
+// googleSafetySettings returns the safetySettings of a Gemini request, or nil
+// if none are configured.
+func (g GenerationConfig) googleSafetySettings() []map[string]interface{} {
+	categories := make([]string, 0, len(g.SafetySettings))
+	for category := range g.SafetySettings {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	var settings []map[string]interface{}
+	for _, category := range categories {
+		settings = append(settings, map[string]interface{}{
+			"category":  category,
+			"threshold": g.SafetySettings[category],
+		})
+	}
+	return settings
+}
+
+// bedrockConfig returns the inferenceConfig object of a Bedrock Converse
+// request. Converse has no seed parameter, so it is not sent.
+func (g GenerationConfig) bedrockConfig() map[string]interface{} {
+	config := map[string]interface{}{
+		"maxTokens": g.maxTokens(),
+	}
+	if g.Temperature != nil {
+		config["temperature"] = *g.Temperature
+	}
+	if g.TopP != nil {
+		config["topP"] = *g.TopP
+	}
+	if len(g.Stop) > 0 {
+		config["stopSequences"] = g.Stop
+	}
+	return config
+}
@@ -0,0 +1,326 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/nexlycode/nexly/internal/sse"
+)
+
+func init() {
+	Register(&googleAdapter{})
+}
+
+// googleAdapter speaks the Gemini generateContent API.
+type googleAdapter struct{}
+
+func (a *googleAdapter) Name() string {
+	return "google"
+}
+
+func (a *googleAdapter) Models() []string {
+	return catalogModels(a.Name())
+}
+
+func (a *googleAdapter) Limits() Limits {
+	return Limits{MaxTemperature: 2, MaxStop: 5}
+}
+
+func (a *googleAdapter) RequiresKey() bool {
+	return true
+}
+
+func (a *googleAdapter) Endpoint(model string) string {
+	return "https://generativelanguage.googleapis.com/v1beta/models/" + model + ":streamGenerateContent?alt=sse"
+}
+
+func (a *googleAdapter) BuildRequest(model string, req Request, gen GenerationConfig) map[string]interface{} {
+	// System messages go in systemInstruction; the contents are only the
+	// user and model turns.
+	var system []map[string]interface{}
+	var messages []Message
+	for _, m := range req.Messages {
+		if m.Role != "system" {
+			messages = append(messages, m)
+			continue
+		}
+		if text := m.Text(); text != "" {
+			system = append(system, map[string]interface{}{"text": text})
+		}
+	}
+
+	body := map[string]interface{}{
+		"contents":         formatGoogleMessages(messages),
+		"generationConfig": gen.googleConfig(),
+	}
+	if len(system) > 0 {
+		body["systemInstruction"] = map[string]interface{}{"parts": system}
+	}
+	if settings := gen.googleSafetySettings(); len(settings) > 0 {
+		body["safetySettings"] = settings
+	}
+	if len(req.Tools) > 0 {
+		body["tools"] = formatGoogleTools(req.Tools)
+	}
+	return body
+}
+
+func (a *googleAdapter) SetHeaders(header http.Header, apiKey string) {
+	header.Set("x-goog-api-key", apiKey)
+	header.Set("Content-Type", "application/json")
+}
+
+func (a *googleAdapter) DecodeStream(body io.Reader, emit EventHandler) (*Response, error) {
+	var content, thinking strings.Builder
+	var calls []ToolCall
+	var usage Usage
+	var stopReason string
+
+	events := sse.NewDecoder(body)
+	for {
+		event, err := events.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+
+		data := event.Data
+
+		if err := decodeStreamError([]byte(data)); err != nil {
+			return nil, err
+		}
+
+		var response struct {
+			Candidates []struct {
+				FinishReason string `json:"finishReason"`
+				Content      struct {
+					Parts []struct {
+						Text string `json:"text"`
+						// Thought marks a summary of the model's
+						// reasoning rather than part of the answer.
+						Thought      bool `json:"thought"`
+						FunctionCall *struct {
+							Name string          `json:"name"`
+							Args json.RawMessage `json:"args"`
+						} `json:"functionCall"`
+					} `json:"parts"`
+				} `json:"content"`
+			} `json:"candidates"`
+			PromptFeedback struct {
+				BlockReason string `json:"blockReason"`
+			} `json:"promptFeedback"`
+			UsageMetadata *struct {
+				PromptTokenCount        int `json:"promptTokenCount"`
+				CandidatesTokenCount    int `json:"candidatesTokenCount"`
+				CachedContentTokenCount int `json:"cachedContentTokenCount"`
+				ThoughtsTokenCount      int `json:"thoughtsTokenCount"`
+			} `json:"usageMetadata"`
+		}
+
+		if err := json.Unmarshal([]byte(data), &response); err != nil {
+			return nil, fmt.Errorf("decoding stream event: %w", err)
+		}
+
+		// A blocked prompt gets no candidates at all.
+		if reason := response.PromptFeedback.BlockReason; reason != "" {
+			return nil, &StreamError{
+				Kind:    ErrContentFiltered,
+				Message: fmt.Sprintf("the prompt was blocked (%s)", reason),
+			}
+		}
+
+		// Every chunk carries the running totals; the last one wins.
+		if u := response.UsageMetadata; u != nil {
+			usage = Usage{
+				InputTokens:  u.PromptTokenCount,
+				OutputTokens: u.CandidatesTokenCount + u.ThoughtsTokenCount,
+				CachedTokens: u.CachedContentTokenCount,
+			}
+		}
+
+		if len(response.Candidates) == 0 {
+			continue
+		}
+
+		if reason := response.Candidates[0].FinishReason; reason != "" {
+			stopReason = googleStopReason(reason)
+			if stopReason == StopContentFilter {
+				return nil, filteredError("finishReason " + reason)
+			}
+		}
+
+		for _, part := range response.Candidates[0].Content.Parts {
+			// Function calls arrive whole, in a single delta.
+			if part.FunctionCall != nil {
+				call := ToolCall{
+					ID:        fmt.Sprintf("call_%d", len(calls)),
+					Name:      part.FunctionCall.Name,
+					Arguments: rawArguments(part.FunctionCall.Args),
+				}
+				emit(Event{Type: EventToolCall, ToolCall: ToolCallDelta{
+					Index:     len(calls),
+					ID:        call.ID,
+					Name:      call.Name,
+					Arguments: call.Arguments,
+				}})
+				calls = append(calls, call)
+				continue
+			}
+			if part.Thought {
+				thinking.WriteString(part.Text)
+				emit(Event{Type: EventThinking, Text: part.Text})
+				continue
+			}
+			if part.Text != "" {
+				content.WriteString(part.Text)
+				emit(Event{Type: EventText, Text: part.Text})
+			}
+		}
+	}
+
+	if stopReason == "" {
+		return nil, errIncompleteStream
+	}
+	// Gemini reports STOP for replies with function calls too.
+	if stopReason == StopEnd && len(calls) > 0 {
+		stopReason = StopToolUse
+	}
+
+	return &Response{
+		Content:    content.String(),
+		ToolCalls:  calls,
+		Thinking:   thinking.String(),
+		Usage:      usage,
+		StopReason: stopReason,
+	}, nil
+}
+
+// googleStopReason maps a finishReason to a Stop constant.
+func googleStopReason(reason string) string {
+	switch reason {
+	case "STOP":
+		return StopEnd
+	case "MAX_TOKENS":
+		return StopMaxTokens
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return StopContentFilter
+	}
+	return reason
+}
+
+func (a *googleAdapter) ModelsEndpoint() string {
+	return "https://generativelanguage.googleapis.com/v1beta/models?pageSize=1000"
+}
+
+// DecodeModels reads the models.list response, keeping the models that can
+// generate content.
+func (a *googleAdapter) DecodeModels(body io.Reader) ([]ModelInfo, error) {
+	var list struct {
+		Models []struct {
+			Name                       string   `json:"name"`
+			InputTokenLimit            int      `json:"inputTokenLimit"`
+			OutputTokenLimit           int      `json:"outputTokenLimit"`
+			SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(body).Decode(&list); err != nil {
+		return nil, err
+	}
+
+	var models []ModelInfo
+	for _, m := range list.Models {
+		for _, method := range m.SupportedGenerationMethods {
+			if method == "generateContent" {
+				models = append(models, ModelInfo{
+					Name:          strings.TrimPrefix(m.Name, "models/"),
+					ContextWindow: m.InputTokenLimit,
+					MaxOutput:     m.OutputTokenLimit,
+				})
+				break
+			}
+		}
+	}
+	return models, nil
+}
+
+// formatGoogleMessages converts the conversation to contents. Consecutive
+// turns of the same role are merged, so the results of parallel function
+// calls are sent together in one turn.
+func formatGoogleMessages(messages []Message) []map[string]interface{} {
+	result := []map[string]interface{}{}
+	for _, m := range messages {
+		// Gemini knows only user and model turns; tool results are sent
+		// by the user.
+		role := "user"
+		if m.Role == "assistant" {
+			role = "model"
+		}
+
+		var parts []map[string]interface{}
+		for _, b := range m.Content {
+			switch b.Type {
+			case BlockText:
+				if b.Text != "" {
+					parts = append(parts, map[string]interface{}{"text": b.Text})
+				}
+			case BlockImage:
+				parts = append(parts, map[string]interface{}{
+					"inline_data": map[string]interface{}{
+						"mime_type": b.Image.MediaType,
+						"data":      b.Image.base64Data(),
+					},
+				})
+			case BlockToolCall:
+				parts = append(parts, map[string]interface{}{
+					"functionCall": map[string]interface{}{
+						"name": b.ToolCall.Name,
+						"args": json.RawMessage(rawArguments(json.RawMessage(b.ToolCall.Arguments))),
+					},
+				})
+			case BlockToolResult:
+				parts = append(parts, map[string]interface{}{
+					"functionResponse": map[string]interface{}{
+						"name": b.ToolResult.Name,
+						"response": map[string]interface{}{
+							"content": b.ToolResult.Content,
+						},
+					},
+				})
+			}
+		}
+
+		if len(parts) == 0 {
+			continue
+		}
+
+		if n := len(result); n > 0 && result[n-1]["role"] == role {
+			prev := result[n-1]["parts"].([]map[string]interface{})
+			result[n-1]["parts"] = append(prev, parts...)
+			continue
+		}
+		result = append(result, map[string]interface{}{
+			"role":  role,
+			"parts": parts,
+		})
+	}
+	return result
+}
+
+func formatGoogleTools(tools []Tool) []map[string]interface{} {
+	declarations := []map[string]interface{}{}
+	for _, t := range tools {
+		declarations = append(declarations, map[string]interface{}{
+			"name":        t.Name,
+			"description": t.Description,
+			"parameters":  t.Parameters,
+		})
+	}
+	return []map[string]interface{}{
+		{"functionDeclarations": declarations},
+	}
+}
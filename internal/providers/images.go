@@ -0,0 +1,67 @@
+package providers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// maxImageSize is the largest image file that can be attached.
+const maxImageSize = 20 << 20
+
+// imageTokens is a rough count of the tokens an image takes up in the
+// prompt, used when estimating the size of the conversation.
+const imageTokens = 1000
+
+// Image is a picture attached to a user message.
+type Image struct {
+	// Name is the file the image came from, for display.
+	Name      string `json:"name,omitempty"`
+	MediaType string `json:"media_type"`
+	// Data is stored apart from the saved history, which refers to it
+	// by SHA256, the hex digest of the data.
+	Data   []byte `json:"data,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// LoadImage reads a PNG, JPEG or WebP file to attach to a message. The
+// format is taken from the file's contents rather than its extension.
+func LoadImage(path string) (Image, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Image{}, err
+	}
+	if info.Size() > maxImageSize {
+		return Image{}, fmt.Errorf("%s is too large to attach (%d MB, at most %d MB)", path, info.Size()>>20, maxImageSize>>20)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Image{}, err
+	}
+
+	mediaType := http.DetectContentType(data)
+	switch mediaType {
+	case "image/png", "image/jpeg", "image/webp":
+	default:
+		return Image{}, fmt.Errorf("%s is not a PNG, JPEG or WebP image (found %s)", path, mediaType)
+	}
+
+	return Image{Name: filepath.Base(path), MediaType: mediaType, Data: data}, nil
+}
+
+// base64Data returns the image encoded for a request body.
+func (img Image) base64Data() string {
+	return base64.StdEncoding.EncodeToString(img.Data)
+}
+
+// CheckVision returns an error if the catalog says the model cannot see
+// images. Models missing from the catalog are given the benefit of the doubt.
+func CheckVision(model string) error {
+	if info, ok := LookupModel(model); ok && !info.Vision {
+		return fmt.Errorf("%s does not accept images; pick a model with vision support", model)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package providers
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Message is one turn of the conversation, made of content blocks. Assistant
+// messages may carry the tool calls the model made; the results are sent
+// back in "tool" messages, one per call.
+type Message struct {
+	Role    string         `json:"role"`
+	Content []ContentBlock `json:"content"`
+	// Usage is the tokens an assistant reply took and Cost what they cost
+	// in US dollars, kept with the reply in the session history.
+	Usage *Usage  `json:"usage,omitempty"`
+	Cost  float64 `json:"cost,omitempty"`
+}
+
+// The types of content block.
+const (
+	BlockText       = "text"
+	BlockImage      = "image"
+	BlockThinking   = "thinking"
+	BlockToolCall   = "tool_call"
+	BlockToolResult = "tool_result"
+)
+
+// ContentBlock is one piece of a message. Type says which of the other
+// fields is set: Text for text and thinking blocks, Image, ToolCall or
+// ToolResult for the others.
+type ContentBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+	// Signature proves thinking came from the model. Anthropic needs
+	// thinking sent back, with its signature, when the turn called tools.
+	Signature  string      `json:"signature,omitempty"`
+	Image      *Image      `json:"image,omitempty"`
+	ToolCall   *ToolCall   `json:"tool_call,omitempty"`
+	ToolResult *ToolResult `json:"tool_result,omitempty"`
+}
+
+// ToolResult is the output of a tool call, sent back to the model.
+type ToolResult struct {
+	CallID  string `json:"call_id"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// TextMessage returns a message holding just the text.
+func TextMessage(role, text string) Message {
+	return Message{Role: role, Content: []ContentBlock{TextBlock(text)}}
+}
+
+// ToolResultMessage returns the message that answers the tool call.
+func ToolResultMessage(call ToolCall, output string) Message {
+	return Message{
+		Role: "tool",
+		Content: []ContentBlock{{
+			Type:       BlockToolResult,
+			ToolResult: &ToolResult{CallID: call.ID, Name: call.Name, Content: output},
+		}},
+	}
+}
+
+func TextBlock(text string) ContentBlock {
+	return ContentBlock{Type: BlockText, Text: text}
+}
+
+func ImageBlock(img Image) ContentBlock {
+	return ContentBlock{Type: BlockImage, Image: &img}
+}
+
+func ThinkingBlock(thinking, signature string) ContentBlock {
+	return ContentBlock{Type: BlockThinking, Text: thinking, Signature: signature}
+}
+
+func ToolCallBlock(call ToolCall) ContentBlock {
+	return ContentBlock{Type: BlockToolCall, ToolCall: &call}
+}
+
+// Text joins the message's text blocks.
+func (m Message) Text() string {
+	var text strings.Builder
+	for _, b := range m.Content {
+		if b.Type == BlockText {
+			text.WriteString(b.Text)
+		}
+	}
+	return text.String()
+}
+
+// Thinking joins the message's thinking blocks.
+func (m Message) Thinking() string {
+	var text strings.Builder
+	for _, b := range m.Content {
+		if b.Type == BlockThinking {
+			text.WriteString(b.Text)
+		}
+	}
+	return text.String()
+}
+
+// ToolCalls returns the tool calls the message makes.
+func (m Message) ToolCalls() []ToolCall {
+	var calls []ToolCall
+	for _, b := range m.Content {
+		if b.Type == BlockToolCall && b.ToolCall != nil {
+			calls = append(calls, *b.ToolCall)
+		}
+	}
+	return calls
+}
+
+// Images returns the images attached to the message.
+func (m Message) Images() []Image {
+	var images []Image
+	for _, b := range m.Content {
+		if b.Type == BlockImage && b.Image != nil {
+			images = append(images, *b.Image)
+		}
+	}
+	return images
+}
+
+// UnmarshalJSON also accepts content given as a plain string, the way
+// session histories were stored before messages had content blocks.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type message Message
+	var raw struct {
+		message
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*m = Message(raw.message)
+
+	var text string
+	if json.Unmarshal(raw.Content, &text) == nil {
+		m.Content = nil
+		if text != "" {
+			m.Content = []ContentBlock{TextBlock(text)}
+		}
+		return nil
+	}
+	if len(raw.Content) == 0 || string(raw.Content) == "null" {
+		m.Content = nil
+		return nil
+	}
+	return json.Unmarshal(raw.Content, &m.Content)
+}
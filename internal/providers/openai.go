@@ -0,0 +1,415 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nexlycode/nexly/internal/sse"
+)
+
+var openAILimits = Limits{MaxTemperature: 2, MaxStop: 4}
+
+func init() {
+	Register(&openAIAdapter{
+		name:        "openai",
+		baseURL:     "https://api.openai.com/v1",
+		requiresKey: true,
+	})
+	Register(&openAIAdapter{
+		name:        "openrouter",
+		baseURL:     "https://openrouter.ai/api/v1",
+		requiresKey: true,
+		headers: map[string]string{
+			"HTTP-Referer": "https://nexlycode.vercel.app",
+			"X-Title":      "Nexly",
+		},
+	})
+	Register(&openAIAdapter{
+		name:        "nvidia",
+		baseURL:     "https://integrate.api.nvidia.com/v1",
+		requiresKey: true,
+	})
+}
+
+// openAIAdapter speaks the OpenAI chat completions API, which OpenRouter,
+// NVIDIA and most self-hosted servers implement as well.
+type openAIAdapter struct {
+	name        string
+	baseURL     string
+	headers     map[string]string
+	models      []string
+	requiresKey bool
+}
+
+// NewOpenAICompatibleAdapter returns an adapter for a server implementing
+// the OpenAI chat completions API, such as Ollama, LM Studio, vLLM or
+// llama.cpp. baseURL is the API root, e.g. "http://localhost:11434/v1".
+// The API key is optional; headers are added to every request.
+func NewOpenAICompatibleAdapter(name, baseURL string, headers map[string]string, models []string) Adapter {
+	return &openAIAdapter{
+		name:    name,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		headers: headers,
+		models:  models,
+	}
+}
+
+func (a *openAIAdapter) Name() string {
+	return a.name
+}
+
+// Models returns the models configured for a custom endpoint, or the
+// catalog's for the built-in ones.
+func (a *openAIAdapter) Models() []string {
+	if a.models != nil {
+		return withDiscovered(a.name, a.models)
+	}
+	return catalogModels(a.name)
+}
+
+func (a *openAIAdapter) Limits() Limits {
+	return openAILimits
+}
+
+func (a *openAIAdapter) RequiresKey() bool {
+	return a.requiresKey
+}
+
+func (a *openAIAdapter) Endpoint(model string) string {
+	return a.baseURL + "/chat/completions"
+}
+
+func (a *openAIAdapter) BuildRequest(model string, req Request, gen GenerationConfig) map[string]interface{} {
+	body := map[string]interface{}{
+		"model":    model,
+		"messages": formatOpenAIMessages(req.Messages),
+		"stream":   true,
+		"stream_options": map[string]interface{}{
+			"include_usage": true,
+		},
+	}
+	gen.applyOpenAI(body)
+	if a.name == "openrouter" {
+		// OpenRouter takes either setting in its own reasoning object.
+		delete(body, "reasoning_effort")
+		if gen.ReasoningEffort != "" {
+			body["reasoning"] = map[string]interface{}{"effort": gen.ReasoningEffort}
+		} else if gen.ThinkingBudget > 0 {
+			body["reasoning"] = map[string]interface{}{"max_tokens": gen.ThinkingBudget}
+		}
+	}
+	if info, _ := LookupModel(model); info.Reasoning {
+		if limit, ok := body["max_tokens"]; ok {
+			delete(body, "max_tokens")
+			body["max_completion_tokens"] = limit
+		}
+	}
+	if len(req.Tools) > 0 {
+		body["tools"] = formatOpenAITools(req.Tools)
+	}
+	return body
+}
+
+func (a *openAIAdapter) SetHeaders(header http.Header, apiKey string) {
+	if apiKey != "" {
+		header.Set("Authorization", "Bearer "+apiKey)
+	}
+	header.Set("Content-Type", "application/json")
+	for k, v := range a.headers {
+		header.Set(k, v)
+	}
+}
+
+func (a *openAIAdapter) DecodeStream(body io.Reader, emit EventHandler) (*Response, error) {
+	var content, thinking strings.Builder
+	var calls toolCallBuilder
+	var usage Usage
+	var stopReason string
+	done := false
+
+	events := sse.NewDecoder(body)
+	for {
+		event, err := events.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+
+		data := event.Data
+		if data == "[DONE]" {
+			done = true
+			break
+		}
+
+		// Errors that happen after the response has started are sent as
+		// an event with an error object instead of choices.
+		if err := decodeStreamError([]byte(data)); err != nil {
+			return nil, err
+		}
+
+		var response struct {
+			Choices []struct {
+				FinishReason string `json:"finish_reason"`
+				Delta        struct {
+					Content string `json:"content"`
+					// OpenRouter streams reasoning as "reasoning",
+					// DeepSeek and vLLM as "reasoning_content".
+					Reasoning        string `json:"reasoning"`
+					ReasoningContent string `json:"reasoning_content"`
+					ToolCalls        []struct {
+						Index    int    `json:"index"`
+						ID       string `json:"id"`
+						Function struct {
+							Name      string `json:"name"`
+							Arguments string `json:"arguments"`
+						} `json:"function"`
+					} `json:"tool_calls"`
+				} `json:"delta"`
+			} `json:"choices"`
+			Usage *struct {
+				PromptTokens        int `json:"prompt_tokens"`
+				CompletionTokens    int `json:"completion_tokens"`
+				PromptTokensDetails struct {
+					CachedTokens int `json:"cached_tokens"`
+				} `json:"prompt_tokens_details"`
+			} `json:"usage"`
+		}
+
+		if err := json.Unmarshal([]byte(data), &response); err != nil {
+			return nil, fmt.Errorf("decoding stream event: %w", err)
+		}
+
+		// With include_usage the counts arrive in a final chunk that
+		// has no choices.
+		if response.Usage != nil {
+			usage = Usage{
+				InputTokens:  response.Usage.PromptTokens,
+				OutputTokens: response.Usage.CompletionTokens,
+				CachedTokens: response.Usage.PromptTokensDetails.CachedTokens,
+			}
+		}
+
+		if len(response.Choices) == 0 {
+			continue
+		}
+
+		if reason := response.Choices[0].FinishReason; reason != "" {
+			stopReason = openAIStopReason(reason)
+		}
+
+		delta := response.Choices[0].Delta
+		if reasoning := delta.Reasoning + delta.ReasoningContent; reasoning != "" {
+			thinking.WriteString(reasoning)
+			emit(Event{Type: EventThinking, Text: reasoning})
+		}
+		if delta.Content != "" {
+			content.WriteString(delta.Content)
+			emit(Event{Type: EventText, Text: delta.Content})
+		}
+
+		for _, tc := range delta.ToolCalls {
+			call := calls.get(tc.Index)
+			if tc.ID != "" {
+				call.ID = tc.ID
+			}
+			if tc.Function.Name != "" {
+				call.Name = tc.Function.Name
+			}
+			call.Arguments += tc.Function.Arguments
+			emit(Event{Type: EventToolCall, ToolCall: ToolCallDelta{
+				Index:     tc.Index,
+				ID:        tc.ID,
+				Name:      tc.Function.Name,
+				Arguments: tc.Function.Arguments,
+			}})
+		}
+	}
+
+	// The usage chunk comes after the finish reason, so a stream cut off
+	// before [DONE] still counts as complete once the reason has arrived.
+	if !done && stopReason == "" {
+		return nil, errIncompleteStream
+	}
+	if stopReason == StopContentFilter {
+		return nil, filteredError("finish_reason content_filter")
+	}
+
+	return &Response{
+		Content:    content.String(),
+		ToolCalls:  calls.result(),
+		Thinking:   thinking.String(),
+		Usage:      usage,
+		StopReason: stopReason,
+	}, nil
+}
+
+// openAIStopReason maps a finish_reason to a Stop constant.
+func openAIStopReason(reason string) string {
+	switch reason {
+	case "stop":
+		return StopEnd
+	case "length":
+		return StopMaxTokens
+	case "tool_calls", "function_call":
+		return StopToolUse
+	case "content_filter":
+		return StopContentFilter
+	}
+	return reason
+}
+
+func (a *openAIAdapter) ModelsEndpoint() string {
+	return a.baseURL + "/models"
+}
+
+// DecodeModels reads a model list. OpenRouter adds context lengths, prices
+// per token and input modalities, which are used when present.
+func (a *openAIAdapter) DecodeModels(body io.Reader) ([]ModelInfo, error) {
+	var list struct {
+		Data []struct {
+			ID            string `json:"id"`
+			ContextLength int    `json:"context_length"`
+			TopProvider   struct {
+				MaxCompletionTokens int `json:"max_completion_tokens"`
+			} `json:"top_provider"`
+			Pricing struct {
+				Prompt     string `json:"prompt"`
+				Completion string `json:"completion"`
+			} `json:"pricing"`
+			Architecture struct {
+				InputModalities []string `json:"input_modalities"`
+			} `json:"architecture"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(body).Decode(&list); err != nil {
+		return nil, err
+	}
+
+	var models []ModelInfo
+	for _, m := range list.Data {
+		if !chatModel(m.ID) {
+			continue
+		}
+		info := ModelInfo{Name: m.ID}
+		if len(m.Architecture.InputModalities) > 0 {
+			info = listedModel(m.ID)
+		}
+		info.ContextWindow = m.ContextLength
+		info.MaxOutput = m.TopProvider.MaxCompletionTokens
+		info.Price = Price{
+			Input:  perMillion(m.Pricing.Prompt),
+			Output: perMillion(m.Pricing.Completion),
+		}
+		for _, modality := range m.Architecture.InputModalities {
+			if modality == "image" {
+				info.Vision = true
+			}
+		}
+		models = append(models, info)
+	}
+	return models, nil
+}
+
+// chatModel reports whether a listed model can be used for chat, leaving
+// out the embedding, speech, image and moderation models OpenAI lists too.
+func chatModel(id string) bool {
+	for _, kind := range []string{"embedding", "whisper", "tts", "dall-e", "moderation", "davinci", "babbage", "transcribe"} {
+		if strings.Contains(id, kind) {
+			return false
+		}
+	}
+	return true
+}
+
+// perMillion converts a price per token, as OpenRouter reports it, to a
+// price per million tokens.
+func perMillion(perToken string) float64 {
+	price, err := strconv.ParseFloat(perToken, 64)
+	if err != nil || price < 0 {
+		return 0
+	}
+	return price * 1e6
+}
+
+// formatOpenAIMessages converts the conversation to chat messages. Each tool
+// result becomes a message of its own, and thinking is not sent back.
+func formatOpenAIMessages(messages []Message) []map[string]interface{} {
+	result := []map[string]interface{}{}
+	for _, m := range messages {
+		var text strings.Builder
+		var parts, calls []map[string]interface{}
+		hasImages := false
+		for _, b := range m.Content {
+			switch b.Type {
+			case BlockText:
+				text.WriteString(b.Text)
+				if b.Text != "" {
+					parts = append(parts, map[string]interface{}{"type": "text", "text": b.Text})
+				}
+			case BlockImage:
+				hasImages = true
+				parts = append(parts, map[string]interface{}{
+					"type": "image_url",
+					"image_url": map[string]interface{}{
+						"url": "data:" + b.Image.MediaType + ";base64," + b.Image.base64Data(),
+					},
+				})
+			case BlockToolCall:
+				calls = append(calls, map[string]interface{}{
+					"id":   b.ToolCall.ID,
+					"type": "function",
+					"function": map[string]interface{}{
+						"name":      b.ToolCall.Name,
+						"arguments": b.ToolCall.Arguments,
+					},
+				})
+			case BlockToolResult:
+				result = append(result, map[string]interface{}{
+					"role":         "tool",
+					"tool_call_id": b.ToolResult.CallID,
+					"content":      b.ToolResult.Content,
+				})
+			}
+		}
+		if m.Role == "tool" {
+			continue
+		}
+
+		msg := map[string]interface{}{
+			"role":    m.Role,
+			"content": text.String(),
+		}
+		if hasImages {
+			msg["content"] = parts
+		}
+		if len(calls) > 0 {
+			msg["tool_calls"] = calls
+			if text.Len() == 0 {
+				msg["content"] = nil
+			}
+		}
+		result = append(result, msg)
+	}
+	return result
+}
+
+func formatOpenAITools(tools []Tool) []map[string]interface{} {
+	result := []map[string]interface{}{}
+	for _, t := range tools {
+		result = append(result, map[string]interface{}{
+			"type": "function",
+			"function": map[string]interface{}{
+				"name":        t.Name,
+				"description": t.Description,
+				"parameters":  t.Parameters,
+			},
+		})
+	}
+	return result
+}
@@ -0,0 +1,37 @@
+package providers
+
+// Price is what a model costs in US dollars per million tokens.
+type Price struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+	// CachedInput is charged for prompt tokens read from the provider's
+	// cache. Zero means cached tokens cost the same as other input.
+	CachedInput float64 `json:"cached_input,omitempty"`
+}
+
+// PriceFor returns the price of the model from the catalog. ok is false for
+// models whose price is unknown, such as local ones.
+func PriceFor(model string) (price Price, ok bool) {
+	info, _ := LookupModel(model)
+	return info.Price, info.Price != (Price{})
+}
+
+// Cost returns what the tokens cost in US dollars.
+func (p Price) Cost(u Usage) float64 {
+	cached := p.CachedInput
+	if cached == 0 {
+		cached = p.Input
+	}
+	input := float64(u.InputTokens-u.CachedTokens)*p.Input + float64(u.CachedTokens)*cached
+	return (input + float64(u.OutputTokens)*p.Output) / 1e6
+}
+
+// Cost returns what the tokens cost on the model, or 0 if its price is
+// unknown.
+func Cost(model string, u Usage) float64 {
+	price, ok := PriceFor(model)
+	if !ok {
+		return 0
+	}
+	return price.Cost(u)
+}
@@ -1,318 +1,223 @@
 package providers
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"strings"
+	"time"
 )
 
-type Message struct {
-	Role    string
-	Content string
+// Request is a single call to the model: the conversation so far and the
+// tools the model is allowed to invoke.
+type Request struct {
+	Messages []Message
+	Tools    []Tool
 }
 
-type StreamCallback func(string)
+// Response is what the model produced once the stream has finished.
+type Response struct {
+	Content   string
+	ToolCalls []ToolCall
+	// Thinking is the reasoning the model streamed before its answer, for
+	// providers that return it.
+	Thinking          string
+	ThinkingSignature string
+	Usage             Usage
+	// StopReason is why the model stopped: one of the Stop constants, or
+	// the provider's own reason if none of them fits.
+	StopReason string
+}
+
+// The reasons a model stops, as reported in Response.StopReason.
+const (
+	StopEnd           = "end"
+	StopMaxTokens     = "max_tokens"
+	StopToolUse       = "tool_use"
+	StopSequence      = "stop_sequence"
+	StopContentFilter = "content_filter"
+)
 
+// Usage counts the tokens of a request. InputTokens includes the prompt
+// tokens served from the provider's cache, which are also counted in
+// CachedTokens.
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	CachedTokens int `json:"cached_tokens,omitempty"`
+}
+
+func (u *Usage) Add(other Usage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.CachedTokens += other.CachedTokens
+}
+
+func (u Usage) IsZero() bool {
+	return u == Usage{}
+}
+
+// Provider sends requests to a model. SendMessage passes the events of the
+// reply to onEvent, which may be nil, as they stream, and returns the
+// complete reply once the stream has finished.
 type Provider interface {
 	Name() string
-	SendMessage(ctx context.Context, messages []Message, streamCallback StreamCallback) error
+	SendMessage(ctx context.Context, req Request, onEvent EventHandler) (*Response, error)
 	GetModels() []string
 }
 
+// SimpleProvider sends requests over HTTP using the wire format of its
+// adapter.
 type SimpleProvider struct {
-	name   string
-	apiKey string
-	model  string
-	apiURL string
+	adapter    Adapter
+	apiKey     string
+	model      string
+	generation GenerationConfig
+	retry      RetryPolicy
+	onRetry    RetryNotifier
 }
 
-func NewSimpleProvider(provider, apiKey, model string) *SimpleProvider {
-	var apiURL string
-	switch provider {
-	case "openai":
-		apiURL = "https://api.openai.com/v1/chat/completions"
-	case "anthropic":
-		apiURL = "https://api.anthropic.com/v1/messages"
-	case "google":
-		apiURL = "https://generativelanguage.googleapis.com/v1beta/models/" + model + ":streamGenerateContent?alt=sse"
-	case "openrouter":
-		apiURL = "https://openrouter.ai/api/v1/chat/completions"
-	case "nvidia":
-		apiURL = "https://integrate.api.nvidia.com/v1/chat/completions"
-	default:
-		apiURL = "https://api.openai.com/v1/chat/completions"
-	}
-
+func NewSimpleProvider(adapter Adapter, apiKey, model string) *SimpleProvider {
 	return &SimpleProvider{
-		name:   provider,
-		apiKey: apiKey,
-		model:  model,
-		apiURL: apiURL,
+		adapter: adapter,
+		apiKey:  apiKey,
+		model:   model,
+		retry:   DefaultRetryPolicy,
 	}
 }
 
-func (p *SimpleProvider) Name() string {
-	return p.name
-}
-
-func (p *SimpleProvider) GetModels() []string {
-	switch p.name {
-	case "openai":
-		return []string{"gpt-4", "gpt-4o", "gpt-4o-mini", "gpt-3.5-turbo"}
-	case "anthropic":
-		return []string{"claude-3-5-sonnet-20241022", "claude-3-opus-20240229"}
-	case "google":
-		return []string{"gemini-1.5-pro", "gemini-1.5-flash"}
-	case "openrouter":
-		return []string{"openai/gpt-4", "anthropic/claude-3.5-sonnet"}
-	case "nvidia":
-		return []string{"nvidia/llama-3.1-nemotron-70b-instruct"}
-	default:
-		return []string{"gpt-4"}
+// New creates a provider for the registered adapter with the given name.
+func New(name, apiKey, model string) (*SimpleProvider, error) {
+	adapter, ok := Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown provider: %s", name)
 	}
+	return NewSimpleProvider(adapter, apiKey, model), nil
 }
 
-func (p *SimpleProvider) SendMessage(ctx context.Context, messages []Message, streamCallback StreamCallback) error {
-	if p.apiKey == "" {
-		return fmt.Errorf("API key not configured for provider: %s", p.name)
-	}
-
-	reqBody := p.buildRequestBody(messages)
-	jsonBody, err := json.Marshal(reqBody)
-	if err != nil {
-		return err
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", p.apiURL, bytes.NewReader(jsonBody))
-	if err != nil {
-		return err
-	}
-
-	p.setHeaders(req)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+// SetGeneration sets the sampling settings used for every request.
+func (p *SimpleProvider) SetGeneration(g GenerationConfig) {
+	p.generation = g
+}
 
-	return p.handleResponse(resp, streamCallback)
+// SetRetry sets the retry policy and a function told about each retry,
+// which may be nil.
+func (p *SimpleProvider) SetRetry(policy RetryPolicy, notify RetryNotifier) {
+	p.retry = policy
+	p.onRetry = notify
 }
 
-func (p *SimpleProvider) buildRequestBody(messages []Message) map[string]interface{} {
-	switch p.name {
-	case "google":
-		return map[string]interface{}{
-			"contents": formatGoogleMessages(messages),
-			"generationConfig": map[string]interface{}{
-				"temperature":     0.7,
-				"maxOutputTokens": 4096,
-			},
-		}
-	case "anthropic":
-		var systemMsg string
-		var userMsgs []Message
-		for _, m := range messages {
-			if m.Role == "system" {
-				systemMsg = m.Content
-			} else {
-				userMsgs = append(userMsgs, m)
-			}
-		}
-		body := map[string]interface{}{
-			"model":      p.model,
-			"messages":   userMsgs,
-			"stream":     true,
-			"max_tokens": 4096,
-		}
-		if systemMsg != "" {
-			body["system"] = systemMsg
-		}
-		return body
-	default:
-		return map[string]interface{}{
-			"model":       p.model,
-			"messages":    messages,
-			"stream":      true,
-			"temperature": 0.7,
-		}
-	}
+func (p *SimpleProvider) Name() string {
+	return p.adapter.Name()
 }
 
-func (p *SimpleProvider) setHeaders(req *http.Request) {
-	switch p.name {
-	case "anthropic":
-		req.Header.Set("x-api-key", p.apiKey)
-		req.Header.Set("anthropic-version", "2023-06-01")
-		req.Header.Set("Content-Type", "application/json")
-	case "google":
-		req.Header.Set("Authorization", "Bearer "+p.apiKey)
-		req.Header.Set("Content-Type", "application/json")
-	case "openrouter":
-		req.Header.Set("Authorization", "Bearer "+p.apiKey)
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("HTTP-Referer", "https://nexlycode.vercel.app")
-		req.Header.Set("X-Title", "Nexly")
-	case "nvidia":
-		req.Header.Set("Authorization", "Bearer "+p.apiKey)
-		req.Header.Set("Content-Type", "application/json")
-	default:
-		req.Header.Set("Authorization", "Bearer "+p.apiKey)
-		req.Header.Set("Content-Type", "application/json")
-	}
+func (p *SimpleProvider) GetModels() []string {
+	return p.adapter.Models()
 }
 
-func (p *SimpleProvider) handleResponse(resp *http.Response, streamCallback StreamCallback) error {
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+func (p *SimpleProvider) SendMessage(ctx context.Context, req Request, onEvent EventHandler) (*Response, error) {
+	if p.apiKey == "" && p.adapter.RequiresKey() {
+		return nil, fmt.Errorf("%w for provider: %s", ErrNoAPIKey, p.Name())
 	}
 
-	reader := bufio.NewReader(resp.Body)
-
-	switch p.name {
-	case "anthropic":
-		return p.handleAnthropicStream(reader, streamCallback)
-	case "google":
-		return p.handleGoogleStream(reader, streamCallback)
-	default:
-		return p.handleOpenAIStream(reader, streamCallback)
+	if err := p.generation.Validate(p.Name()); err != nil {
+		return nil, err
 	}
-}
 
-func (p *SimpleProvider) handleOpenAIStream(reader *bufio.Reader, streamCallback StreamCallback) error {
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
-				break
+	for _, m := range req.Messages {
+		if len(m.Images()) > 0 {
+			if err := CheckVision(p.model); err != nil {
+				return nil, err
 			}
-			return err
-		}
-
-		line = strings.TrimSpace(line)
-		if !strings.HasPrefix(line, "data: ") {
-			continue
-		}
-
-		data := strings.TrimPrefix(line, "data: ")
-		if data == "[DONE]" {
 			break
 		}
+	}
 
-		var response struct {
-			Choices []struct {
-				Delta struct {
-					Content string `json:"content"`
-				} `json:"delta"`
-			} `json:"choices"`
-		}
-
-		if err := json.Unmarshal([]byte(data), &response); err != nil {
-			continue
-		}
+	info, _ := LookupModel(p.model)
+	req, gen := info.adapt(req, p.generation)
+	if err := info.checkThinking(gen); err != nil {
+		return nil, err
+	}
+	reqBody := p.adapter.BuildRequest(p.model, req, gen)
+	jsonBody, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
 
-		if len(response.Choices) > 0 && response.Choices[0].Delta.Content != "" {
-			streamCallback(response.Choices[0].Delta.Content)
+	// A request is retried only while nothing has reached the caller, so a
+	// retry never repeats text that was already shown.
+	streamed := false
+	emit := func(e Event) {
+		streamed = true
+		if onEvent != nil {
+			onEvent(e)
 		}
 	}
 
-	return nil
-}
-
-func (p *SimpleProvider) handleAnthropicStream(reader *bufio.Reader, streamCallback StreamCallback) error {
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return err
+	for attempt := 1; ; attempt++ {
+		resp, err := p.send(ctx, jsonBody, emit)
+		if err == nil {
+			emit(Event{Type: EventUsage, Usage: resp.Usage})
+			emit(Event{Type: EventStop, StopReason: resp.StopReason})
+			return resp, nil
 		}
-
-		line = strings.TrimSpace(line)
-		if !strings.HasPrefix(line, "data: ") {
-			continue
+		if streamed || attempt >= p.retry.MaxAttempts || ctx.Err() != nil || !retryable(err) {
+			return nil, err
 		}
 
-		data := strings.TrimPrefix(line, "data: ")
-
-		var response struct {
-			Delta struct {
-				Text string `json:"text"`
-			} `json:"delta"`
+		wait, ok := p.retry.delay(attempt, err)
+		if !ok {
+			return nil, err
 		}
-
-		if err := json.Unmarshal([]byte(data), &response); err != nil {
-			continue
+		if p.onRetry != nil {
+			p.onRetry(attempt, wait, err)
 		}
 
-		if response.Delta.Text != "" {
-			streamCallback(response.Delta.Text)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
 		}
 	}
-
-	return nil
 }
 
-func (p *SimpleProvider) handleGoogleStream(reader *bufio.Reader, streamCallback StreamCallback) error {
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return err
-		}
-
-		line = strings.TrimSpace(line)
-		if !strings.HasPrefix(line, "data: ") {
-			continue
-		}
+func (p *SimpleProvider) send(ctx context.Context, jsonBody []byte, emit EventHandler) (*Response, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.adapter.Endpoint(p.model), bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, err
+	}
 
-		data := strings.TrimPrefix(line, "data: ")
+	if err := p.authorize(httpReq, jsonBody); err != nil {
+		return nil, err
+	}
 
-		var response struct {
-			Candidates []struct {
-				Content struct {
-					Parts []struct {
-						Text string `json:"text"`
-					} `json:"parts"`
-				} `json:"content"`
-			} `json:"candidates"`
-		}
+	client := &http.Client{}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 
-		if err := json.Unmarshal([]byte(data), &response); err != nil {
-			continue
-		}
+	return p.handleResponse(resp, emit)
+}
 
-		if len(response.Candidates) > 0 && len(response.Candidates[0].Content.Parts) > 0 {
-			streamCallback(response.Candidates[0].Content.Parts[0].Text)
-		}
+// authorize sets the adapter's headers on the request and, for adapters
+// that sign requests, signs it along with its body.
+func (p *SimpleProvider) authorize(httpReq *http.Request, body []byte) error {
+	p.adapter.SetHeaders(httpReq.Header, p.apiKey)
+	if signer, ok := p.adapter.(RequestSigner); ok {
+		return signer.SignRequest(httpReq, body)
 	}
-
 	return nil
 }
 
-func formatGoogleMessages(messages []Message) []map[string]interface{} {
-	result := []map[string]interface{}{}
-	for _, m := range messages {
-		role := m.Role
-		if role == "system" {
-			role = "model"
-		}
-		result = append(result, map[string]interface{}{
-			"role": role,
-			"parts": []map[string]string{
-				{"text": m.Content},
-			},
-		})
+func (p *SimpleProvider) handleResponse(resp *http.Response, emit EventHandler) (*Response, error) {
+	if resp.StatusCode != 200 {
+		return nil, newStatusError(resp)
 	}
-	return result
+
+	return p.adapter.DecodeStream(resp.Body, emit)
 }
@@ -0,0 +1,115 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// Adapter implements the wire format of one provider: where requests go,
+// how they are encoded and authenticated, and how the streamed reply is
+// decoded. Adapters register themselves from an init function, which makes
+// them available to the CLI, the TUI and the config by name.
+type Adapter interface {
+	Name() string
+	Models() []string
+	Limits() Limits
+	// RequiresKey reports whether requests fail without an API key.
+	RequiresKey() bool
+	Endpoint(model string) string
+	BuildRequest(model string, req Request, gen GenerationConfig) map[string]interface{}
+	SetHeaders(header http.Header, apiKey string)
+	// DecodeStream reads the streamed reply, passing the pieces of text,
+	// thinking and tool calls to emit as they arrive.
+	DecodeStream(body io.Reader, emit EventHandler) (*Response, error)
+	// ModelsEndpoint is where the provider lists the models it serves,
+	// which DecodeModels reads. Only what the listing reports is filled in.
+	ModelsEndpoint() string
+	DecodeModels(body io.Reader) ([]ModelInfo, error)
+}
+
+// RequestSigner is implemented by adapters that authenticate by signing
+// each request, such as Bedrock's, rather than with a key in a header.
+// SignRequest is called once the headers are set, with the body about to
+// be sent.
+type RequestSigner interface {
+	SignRequest(req *http.Request, body []byte) error
+}
+
+// Limits are the generation setting ranges a provider accepts.
+type Limits struct {
+	MaxTemperature float64
+	// MaxStop is the number of stop sequences allowed; 0 means no limit.
+	MaxStop int
+	// MinThinkingBudget is the smallest thinking budget accepted.
+	MinThinkingBudget int
+}
+
+var adapters = make(map[string]Adapter)
+
+// Register makes an adapter available under its name. It panics if the name
+// is already taken, since that can only be a programming error.
+func Register(a Adapter) {
+	if _, exists := adapters[a.Name()]; exists {
+		panic(fmt.Sprintf("providers: adapter %q registered twice", a.Name()))
+	}
+	adapters[a.Name()] = a
+}
+
+// AdapterFactory builds an adapter from the provider's settings in the
+// config, a JSON object that is empty when none are set.
+type AdapterFactory func(settings json.RawMessage) (Adapter, error)
+
+var factories = make(map[string]AdapterFactory)
+
+// RegisterFactory lets the adapter registered under name be built from the
+// config, for providers that need more than a key, such as the address of
+// the resource to use. It panics if the name already has a factory.
+func RegisterFactory(name string, f AdapterFactory) {
+	if _, exists := factories[name]; exists {
+		panic(fmt.Sprintf("providers: factory %q registered twice", name))
+	}
+	factories[name] = f
+}
+
+// Configure returns the adapter for the named provider, built from settings
+// if the provider registered a factory and the registered adapter otherwise.
+func Configure(name string, settings json.RawMessage) (Adapter, error) {
+	if f, ok := factories[name]; ok {
+		if len(settings) == 0 {
+			settings = json.RawMessage("{}")
+		}
+		return f(settings)
+	}
+	if a, ok := Lookup(name); ok {
+		return a, nil
+	}
+	return nil, fmt.Errorf("unknown provider: %s", name)
+}
+
+// Lookup returns the adapter registered under name.
+func Lookup(name string) (Adapter, bool) {
+	a, ok := adapters[name]
+	return a, ok
+}
+
+// Names lists the registered providers in alphabetical order.
+func Names() []string {
+	var names []string
+	for name := range adapters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// limitsFor returns the limits of a registered provider, or the OpenAI ones
+// for names that are not registered such as custom endpoints.
+func limitsFor(provider string) Limits {
+	if a, ok := Lookup(provider); ok {
+		return a.Limits()
+	}
+	return openAILimits
+}
@@ -0,0 +1,155 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how failed requests are retried. Requests are only
+// retried when nothing has been streamed to the caller yet.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   time.Second,
+	MaxDelay:    time.Minute,
+}
+
+// RetryNotifier is called before waiting to retry a request. attempt is the
+// number of the attempt that failed.
+type RetryNotifier func(attempt int, wait time.Duration, err error)
+
+// retryable reports whether a failed request may succeed if sent again.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	// An account out of credit stays that way however long we wait.
+	if errors.Is(err, ErrQuota) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests,
+			http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout,
+			529: // Anthropic: overloaded
+			return true
+		}
+		return false
+	}
+
+	// Errors sent in the stream have no status, only a kind.
+	var streamErr *StreamError
+	if errors.As(err, &streamErr) {
+		return streamErr.Kind == ErrOverloaded || streamErr.Kind == ErrRateLimit
+	}
+
+	// Every failure of http.Client.Do is a net.Error, including bad
+	// certificates and malformed URLs, so only the failures of the
+	// connection itself are retried: it could not be opened, timed out
+	// or was cut.
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return false
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// delay returns how long to wait before the attempt after the given one: the
+// time the provider asked for if it did, and exponential backoff with jitter
+// otherwise, waiting at least until an exhausted rate limit resets but no
+// longer than MaxDelay. ok is false when the provider asks for longer than
+// MaxDelay.
+func (r RetryPolicy) delay(attempt int, err error) (time.Duration, bool) {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		return statusErr.RetryAfter, statusErr.RetryAfter <= r.MaxDelay
+	}
+
+	d := r.BaseDelay << uint(attempt-1)
+	if d <= 0 || d > r.MaxDelay {
+		d = r.MaxDelay
+	}
+	d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	if statusErr != nil && statusErr.ResetAfter > d {
+		d = min(statusErr.ResetAfter, r.MaxDelay)
+	}
+	return d, true
+}
+
+// retryAfter reads how long to wait from the Retry-After header, or the
+// millisecond variant OpenAI sends.
+func retryAfter(h http.Header, now time.Time) time.Duration {
+	if ms, err := strconv.Atoi(h.Get("retry-after-ms")); err == nil && ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+
+	if v := h.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return positive(t.Sub(now))
+		}
+	}
+	return 0
+}
+
+// rateLimitReset returns when the exhausted rate limits reset, according to
+// the providers' rate limit headers. Limits with requests or tokens left are
+// not waited for, however long until they reset.
+func rateLimitReset(h http.Header, now time.Time) time.Duration {
+	var wait time.Duration
+
+	// OpenAI reports resets as durations such as "1s" or "6m0s".
+	for _, limit := range []string{"requests", "tokens"} {
+		if h.Get("x-ratelimit-remaining-"+limit) != "0" {
+			continue
+		}
+		if d, err := time.ParseDuration(h.Get("x-ratelimit-reset-" + limit)); err == nil && d > wait {
+			wait = d
+		}
+	}
+
+	// Anthropic reports them as RFC 3339 timestamps.
+	for _, limit := range []string{"requests", "tokens", "input-tokens", "output-tokens"} {
+		if h.Get("anthropic-ratelimit-"+limit+"-remaining") != "0" {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339, h.Get("anthropic-ratelimit-"+limit+"-reset")); err == nil && t.Sub(now) > wait {
+			wait = t.Sub(now)
+		}
+	}
+
+	return wait
+}
+
+func positive(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
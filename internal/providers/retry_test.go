@@ -0,0 +1,137 @@
+package providers
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRateLimitResetWaitsOnlyForExhaustedLimits(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   time.Duration
+	}{
+		{"openai requests exhausted", map[string]string{
+			"x-ratelimit-remaining-requests": "0",
+			"x-ratelimit-reset-requests":     "1s",
+			"x-ratelimit-remaining-tokens":   "149984",
+			"x-ratelimit-reset-tokens":       "6m0s",
+		}, time.Second},
+		{"openai tokens exhausted", map[string]string{
+			"x-ratelimit-remaining-requests": "59",
+			"x-ratelimit-reset-requests":     "1s",
+			"x-ratelimit-remaining-tokens":   "0",
+			"x-ratelimit-reset-tokens":       "6m0s",
+		}, 6 * time.Minute},
+		{"openai nothing exhausted", map[string]string{
+			"x-ratelimit-remaining-requests": "59",
+			"x-ratelimit-reset-requests":     "1s",
+			"x-ratelimit-reset-tokens":       "6m0s",
+		}, 0},
+		{"anthropic tokens exhausted", map[string]string{
+			"anthropic-ratelimit-requests-remaining": "10",
+			"anthropic-ratelimit-requests-reset":     "2024-06-01T12:10:00Z",
+			"anthropic-ratelimit-tokens-remaining":   "0",
+			"anthropic-ratelimit-tokens-reset":       "2024-06-01T12:00:30Z",
+		}, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		for k, v := range tt.header {
+			h.Set(k, v)
+		}
+		if got := rateLimitReset(h, now); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDelayCapsRateLimitResetAtMaxDelay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 4, BaseDelay: time.Second, MaxDelay: time.Minute}
+
+	wait, ok := policy.delay(1, &StatusError{StatusCode: http.StatusTooManyRequests, ResetAfter: 6 * time.Minute})
+	if !ok || wait != time.Minute {
+		t.Errorf("reset in 6m: got wait=%v ok=%v, want 1m0s true", wait, ok)
+	}
+
+	wait, ok = policy.delay(1, &StatusError{StatusCode: http.StatusTooManyRequests, ResetAfter: 20 * time.Second})
+	if !ok || wait != 20*time.Second {
+		t.Errorf("reset in 20s: got wait=%v ok=%v, want 20s true", wait, ok)
+	}
+
+	if _, ok := policy.delay(1, &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 6 * time.Minute}); ok {
+		t.Error("retried although Retry-After asked for longer than MaxDelay")
+	}
+}
+
+func TestQuotaErrorsAreNotRetried(t *testing.T) {
+	body := []byte(`{"error":{"message":"You exceeded your current quota, please check your plan and billing details.","type":"insufficient_quota","param":null,"code":"insufficient_quota"}}`)
+	kind, _ := classifyError(http.StatusTooManyRequests, body)
+	err := &StatusError{StatusCode: http.StatusTooManyRequests, Kind: kind}
+	if kind != ErrQuota {
+		t.Fatalf("classified as %v, want ErrQuota", kind)
+	}
+	if retryable(err) {
+		t.Error("retried a request that failed for lack of quota")
+	}
+}
+
+func TestOnlyConnectionFailuresAreRetried(t *testing.T) {
+	// A port nothing listens on refuses the connection.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := "http://" + ln.Addr().String()
+	ln.Close()
+
+	tls := httptest.NewUnstartedServer(http.NotFoundHandler())
+	tls.Config.ErrorLog = log.New(io.Discard, "", 0)
+	tls.StartTLS()
+	defer tls.Close()
+
+	client := &http.Client{}
+	send := func(url string) error {
+		req, err := http.NewRequest("POST", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"connection refused", send(closed), true},
+		{"untrusted certificate", send(tls.URL), false},
+		{"unsupported scheme", send("ftp://example.com/v1"), false},
+		{"connection reset", &url.Error{Op: "Post", URL: "https://api.example.com", Err: &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}, true},
+		{"run deadline", &url.Error{Op: "Post", URL: "https://api.example.com", Err: context.DeadlineExceeded}, false},
+		{"dial timeout", &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}, true},
+		{"unexpected EOF", errIncompleteStream, true},
+	}
+	for _, tt := range tests {
+		if tt.err == nil {
+			t.Fatalf("%s: request did not fail", tt.name)
+		}
+		if got := retryable(tt.err); got != tt.want {
+			t.Errorf("%s: retryable(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
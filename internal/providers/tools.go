@@ -0,0 +1,72 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Tool describes a function the model may call. Parameters is a JSON schema
+// object describing the arguments.
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  map[string]interface{}
+}
+
+// ToolCall is a completed tool invocation requested by the model. Arguments
+// holds the raw JSON object produced by the model.
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// toolCallBuilder collects tool calls whose id, name and arguments arrive
+// spread over several stream deltas, keyed by the index the provider assigns.
+type toolCallBuilder struct {
+	calls []*ToolCall
+	index map[int]*ToolCall
+}
+
+func (b *toolCallBuilder) get(index int) *ToolCall {
+	if b.index == nil {
+		b.index = make(map[int]*ToolCall)
+	}
+	call, ok := b.index[index]
+	if !ok {
+		call = &ToolCall{}
+		b.index[index] = call
+		b.calls = append(b.calls, call)
+	}
+	return call
+}
+
+func (b *toolCallBuilder) has(index int) bool {
+	_, ok := b.index[index]
+	return ok
+}
+
+func (b *toolCallBuilder) result() []ToolCall {
+	var result []ToolCall
+	for i, call := range b.calls {
+		c := *call
+		if c.ID == "" {
+			c.ID = fmt.Sprintf("call_%d", i)
+		}
+		if c.Arguments == "" {
+			c.Arguments = "{}"
+		}
+		result = append(result, c)
+	}
+	return result
+}
+
+// rawArguments normalizes tool call arguments to a JSON object string, so
+// every provider reports calls the same way and a malformed value from the
+// model never ends up inside a request body.
+func rawArguments(args json.RawMessage) string {
+	if len(args) == 0 || string(args) == "null" || !json.Valid(args) {
+		return "{}"
+	}
+	return string(args)
+}
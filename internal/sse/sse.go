@@ -0,0 +1,152 @@
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is one event of a stream. Type is "message" unless the stream named
+// it, and ID is the last event ID the stream set.
+type Event struct {
+	Type string
+	Data string
+	ID   string
+}
+
+// Decoder reads server-sent events as the HTML specification defines them:
+// lines may end in CRLF, LF or CR, data fields are joined with newlines,
+// comments are skipped and an event is dispatched at each blank line.
+type Decoder struct {
+	r       *bufio.Reader
+	started bool
+	// afterCR is set when the last line ended in CR, so a LF right after
+	// it belongs to the same line ending.
+	afterCR bool
+
+	eventType string
+	data      strings.Builder
+	hasData   bool
+	lastID    string
+	retry     time.Duration
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Next returns the next event. It returns io.EOF once the stream has ended;
+// an event the stream did not finish with a blank line is discarded.
+func (d *Decoder) Next() (Event, error) {
+	for {
+		line, err := d.readLine()
+		if err != nil {
+			return Event{}, err
+		}
+
+		if line == "" {
+			if event, ok := d.dispatch(); ok {
+				return event, nil
+			}
+			continue
+		}
+		d.processLine(line)
+	}
+}
+
+// Retry returns the reconnection time the stream last asked for, or 0.
+func (d *Decoder) Retry() time.Duration {
+	return d.retry
+}
+
+func (d *Decoder) dispatch() (Event, bool) {
+	defer func() {
+		d.eventType = ""
+		d.data.Reset()
+		d.hasData = false
+	}()
+
+	if !d.hasData {
+		return Event{}, false
+	}
+	event := Event{
+		Type: d.eventType,
+		Data: strings.TrimSuffix(d.data.String(), "\n"),
+		ID:   d.lastID,
+	}
+	if event.Type == "" {
+		event.Type = "message"
+	}
+	return event, true
+}
+
+func (d *Decoder) processLine(line string) {
+	if strings.HasPrefix(line, ":") {
+		return
+	}
+
+	field, value, _ := strings.Cut(line, ":")
+	value = strings.TrimPrefix(value, " ")
+
+	switch field {
+	case "event":
+		d.eventType = value
+	case "data":
+		d.data.WriteString(value)
+		d.data.WriteByte('\n')
+		d.hasData = true
+	case "id":
+		if !strings.Contains(value, "\x00") {
+			d.lastID = value
+		}
+	case "retry":
+		// Only a value of ASCII digits counts.
+		if value == "" || strings.Trim(value, "0123456789") != "" {
+			return
+		}
+		if ms, err := strconv.Atoi(value); err == nil {
+			d.retry = time.Duration(ms) * time.Millisecond
+		}
+	}
+}
+
+// readLine returns the next line without its ending, which may be CRLF, LF
+// or a lone CR. A byte order mark at the start of the stream is dropped.
+// A line ending in CR is returned without waiting for the next byte, which
+// on a live stream may not come until the next event.
+func (d *Decoder) readLine() (string, error) {
+	var line bytes.Buffer
+	for {
+		b, err := d.r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+
+		if d.afterCR {
+			d.afterCR = false
+			if b == '\n' {
+				continue
+			}
+		}
+
+		switch b {
+		case '\n':
+			return d.text(line.Bytes()), nil
+		case '\r':
+			d.afterCR = true
+			return d.text(line.Bytes()), nil
+		}
+		line.WriteByte(b)
+	}
+}
+
+func (d *Decoder) text(line []byte) string {
+	if !d.started {
+		d.started = true
+		line = bytes.TrimPrefix(line, []byte("\xef\xbb\xbf"))
+	}
+	return string(line)
+}
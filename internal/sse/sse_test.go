@@ -0,0 +1,221 @@
+package sse
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readAll decodes every event of the stream.
+func readAll(t *testing.T, r io.Reader) ([]Event, *Decoder) {
+	t.Helper()
+	d := NewDecoder(r)
+	var events []Event
+	for {
+		event, err := d.Next()
+		if err == io.EOF {
+			return events, d
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		events = append(events, event)
+	}
+}
+
+// TestTranscripts decodes streams recorded from the providers. The Gemini
+// one ends its lines in CRLF, and OpenRouter sends comments while the
+// request is queued.
+func TestTranscripts(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want []Event
+	}{
+		{
+			name: "OpenAI",
+			file: "openai.txt",
+			want: []Event{
+				{Type: "message", Data: `{"id":"chatcmpl-AJ5mZ8Yk2l3xq","object":"chat.completion.chunk","created":1729080000,"model":"gpt-4o-2024-08-06","system_fingerprint":"fp_a7d06e42a7","choices":[{"index":0,"delta":{"role":"assistant","content":"","refusal":null},"logprobs":null,"finish_reason":null}],"usage":null}`},
+				{Type: "message", Data: `{"id":"chatcmpl-AJ5mZ8Yk2l3xq","object":"chat.completion.chunk","created":1729080000,"model":"gpt-4o-2024-08-06","system_fingerprint":"fp_a7d06e42a7","choices":[{"index":0,"delta":{"content":"Hello"},"logprobs":null,"finish_reason":null}],"usage":null}`},
+				{Type: "message", Data: `{"id":"chatcmpl-AJ5mZ8Yk2l3xq","object":"chat.completion.chunk","created":1729080000,"model":"gpt-4o-2024-08-06","system_fingerprint":"fp_a7d06e42a7","choices":[{"index":0,"delta":{"content":"!"},"logprobs":null,"finish_reason":null}],"usage":null}`},
+				{Type: "message", Data: `{"id":"chatcmpl-AJ5mZ8Yk2l3xq","object":"chat.completion.chunk","created":1729080000,"model":"gpt-4o-2024-08-06","system_fingerprint":"fp_a7d06e42a7","choices":[{"index":0,"delta":{},"logprobs":null,"finish_reason":"stop"}],"usage":null}`},
+				{Type: "message", Data: `{"id":"chatcmpl-AJ5mZ8Yk2l3xq","object":"chat.completion.chunk","created":1729080000,"model":"gpt-4o-2024-08-06","system_fingerprint":"fp_a7d06e42a7","choices":[],"usage":{"prompt_tokens":9,"completion_tokens":2,"total_tokens":11,"prompt_tokens_details":{"cached_tokens":0},"completion_tokens_details":{"reasoning_tokens":0}}}`},
+				{Type: "message", Data: `[DONE]`},
+			},
+		},
+		{
+			name: "Anthropic",
+			file: "anthropic.txt",
+			want: []Event{
+				{Type: "message_start", Data: `{"type":"message_start","message":{"id":"msg_01XFDUDYJgAACzvnptvVoYEL","type":"message","role":"assistant","content":[],"model":"claude-3-5-sonnet-20241022","stop_reason":null,"stop_sequence":null,"usage":{"input_tokens":25,"output_tokens":1}}}`},
+				{Type: "content_block_start", Data: `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`},
+				{Type: "ping", Data: `{"type": "ping"}`},
+				{Type: "content_block_delta", Data: `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}`},
+				{Type: "content_block_delta", Data: `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"!"}}`},
+				{Type: "content_block_stop", Data: `{"type":"content_block_stop","index":0}`},
+				{Type: "message_delta", Data: `{"type":"message_delta","delta":{"stop_reason":"end_turn","stop_sequence":null},"usage":{"output_tokens":15}}`},
+				{Type: "message_stop", Data: `{"type":"message_stop"}`},
+			},
+		},
+		{
+			name: "Gemini",
+			file: "gemini.txt",
+			want: []Event{
+				{Type: "message", Data: `{"candidates": [{"content": {"parts": [{"text": "Hello"}],"role": "model"}}],"usageMetadata": {"promptTokenCount": 4,"totalTokenCount": 4},"modelVersion": "gemini-1.5-flash-002"}`},
+				{Type: "message", Data: `{"candidates": [{"content": {"parts": [{"text": "! How can I help?"}],"role": "model"},"finishReason": "STOP"}],"usageMetadata": {"promptTokenCount": 4,"candidatesTokenCount": 9,"totalTokenCount": 13},"modelVersion": "gemini-1.5-flash-002"}`},
+			},
+		},
+		{
+			name: "OpenRouter",
+			file: "openrouter.txt",
+			want: []Event{
+				{Type: "message", Data: `{"id":"gen-1729080000-kQ2nJ7rT","provider":"Together","model":"meta-llama/llama-3.1-70b-instruct","object":"chat.completion.chunk","created":1729080000,"choices":[{"index":0,"delta":{"role":"assistant","content":"Hello"},"finish_reason":null,"logprobs":null}]}`},
+				{Type: "message", Data: `{"id":"gen-1729080000-kQ2nJ7rT","provider":"Together","model":"meta-llama/llama-3.1-70b-instruct","object":"chat.completion.chunk","created":1729080000,"choices":[{"index":0,"delta":{"role":"assistant","content":"!"},"finish_reason":"stop","logprobs":null}],"usage":{"prompt_tokens":14,"completion_tokens":3,"total_tokens":17}}`},
+				{Type: "message", Data: `[DONE]`},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			got, _ := readAll(t, f)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %d events:\n%q\nwant %d:\n%q", len(got), got, len(tt.want), tt.want)
+			}
+		})
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []Event
+		retry time.Duration
+	}{
+		{
+			name:  "multi-line data",
+			input: "data: first\ndata: second\ndata:\n\n",
+			want:  []Event{{Type: "message", Data: "first\nsecond\n"}},
+		},
+		{
+			name:  "data without a space",
+			input: "data:x\n\ndata:  two spaces\n\n",
+			want:  []Event{{Type: "message", Data: "x"}, {Type: "message", Data: " two spaces"}},
+		},
+		{
+			name:  "field without a colon",
+			input: "data\n\n",
+			want:  []Event{{Type: "message", Data: ""}},
+		},
+		{
+			name:  "keep-alive comments",
+			input: ": keep-alive\n\n:\ndata: x\n: inside an event\n\n",
+			want:  []Event{{Type: "message", Data: "x"}},
+		},
+		{
+			name:  "event, id and retry",
+			input: "event: update\nid: 7\nretry: 3000\ndata: a\n\ndata: b\n\n",
+			want: []Event{
+				{Type: "update", Data: "a", ID: "7"},
+				{Type: "message", Data: "b", ID: "7"},
+			},
+			retry: 3 * time.Second,
+		},
+		{
+			name:  "invalid retry and id",
+			input: "retry: 1s\nid: a\x00b\ndata: x\n\n",
+			want:  []Event{{Type: "message", Data: "x"}},
+		},
+		{
+			name:  "event without data",
+			input: "event: ping\n\ndata: x\n\n",
+			want:  []Event{{Type: "message", Data: "x"}},
+		},
+		{
+			name:  "CRLF",
+			input: "event: a\r\ndata: 1\r\n\r\ndata: 2\r\n\r\n",
+			want:  []Event{{Type: "a", Data: "1"}, {Type: "message", Data: "2"}},
+		},
+		{
+			name:  "lone CR",
+			input: "event: a\rdata: 1\r\rdata: 2\r\r",
+			want:  []Event{{Type: "a", Data: "1"}, {Type: "message", Data: "2"}},
+		},
+		{
+			name:  "mixed line endings",
+			input: "data: 1\r\n\ndata: 2\r\rdata: 3\n\r\n",
+			want: []Event{
+				{Type: "message", Data: "1"},
+				{Type: "message", Data: "2"},
+				{Type: "message", Data: "3"},
+			},
+		},
+		{
+			name:  "byte order mark",
+			input: "\xef\xbb\xbfdata: x\n\n",
+			want:  []Event{{Type: "message", Data: "x"}},
+		},
+		{
+			name:  "unfinished event",
+			input: "data: x\n\ndata: cut off\n",
+			want:  []Event{{Type: "message", Data: "x"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, d := readAll(t, strings.NewReader(tt.input))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if d.Retry() != tt.retry {
+				t.Errorf("retry = %v, want %v", d.Retry(), tt.retry)
+			}
+		})
+	}
+}
+
+// TestLoneCRNotDelayed checks that an event ending in CR is dispatched as
+// soon as it arrives, without waiting for the byte after it.
+func TestLoneCRNotDelayed(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	go w.Write([]byte("data: 1\r\r"))
+
+	d := NewDecoder(r)
+	got := make(chan Event)
+	go func() {
+		event, err := d.Next()
+		if err == nil {
+			got <- event
+		}
+	}()
+
+	select {
+	case event := <-got:
+		if event.Data != "1" {
+			t.Errorf("got %q, want 1", event.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("event not dispatched until more data arrived")
+	}
+
+	// A LF after the CR ends the same line, not an empty one.
+	go w.Write([]byte("\ndata: 2\r\r"))
+	event, err := d.Next()
+	if err != nil || event.Data != "2" {
+		t.Errorf("got %q, %v; want 2", event.Data, err)
+	}
+}
@@ -2,17 +2,19 @@ package tui
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
-	"sync"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/mattn/go-runewidth"
+	"github.com/nexlycode/nexly/internal/agent"
 	"github.com/nexlycode/nexly/internal/config"
 	"github.com/nexlycode/nexly/internal/handlers"
+	"github.com/nexlycode/nexly/internal/permissions"
 	"github.com/nexlycode/nexly/internal/providers"
 	"github.com/nexlycode/nexly/internal/utils"
 )
@@ -21,27 +23,37 @@ var (
 	primaryStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("86"))
 	secondaryStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
 	errorStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("196"))
-	
+
 	userBubbleStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("255")).
 			Background(lipgloss.Color("57")).
 			Padding(0, 1)
-	
+
 	assistantBubbleStyle = lipgloss.NewStyle().
 				Foreground(lipgloss.Color("255")).
 				Background(lipgloss.Color("63")).
 				Padding(0, 1)
+
+	toolBubbleStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("255")).
+			Background(lipgloss.Color("240")).
+			Padding(0, 1)
+
+	thinkingStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("241")).Italic(true)
 )
 
 type model struct {
-	messages     []Message
+	messages     []entry
 	input        string
 	provider     string
 	model        string
 	streaming    bool
 	spinner      bool
 	spinnerFrame int
-	spinnerMutex sync.Mutex
+	partial      string
+	thinking     string
+	showThinking bool
+	attachments  []providers.Image
 	width        int
 	height       int
 	commandView  bool
@@ -49,11 +61,35 @@ type model struct {
 	selectedCmd  int
 	commandInput string
 	errMsg       string
+	errHint      string
+	maxSteps     int
+	maxContinue  int
+	continued    int
+	permission   *permissionRequest
+	history      []providers.Message
+	cancel       context.CancelFunc
+	generation   providers.GenerationConfig
+	retry        *retryScheduled
+	usage        providers.Usage
+	cost         float64
+	warning      string
 }
 
-type Message struct {
-	Role    string
-	Content string
+// entry is a message in the transcript, along with what is shown about it.
+// A reply's Cost is shown after it.
+type entry struct {
+	providers.Message
+	Interrupted bool
+	// StopReason is shown after the reply when the model stopped for a
+	// reason other than finishing its answer.
+	StopReason string
+	// Continued counts the continuation requests the reply took.
+	Continued int
+}
+
+// notice returns a transcript entry telling the user something.
+func notice(text string) entry {
+	return entry{Message: providers.TextMessage("assistant", text)}
 }
 
 type Command struct {
@@ -62,26 +98,38 @@ type Command struct {
 	Action      func(*model) (tea.Model, tea.Cmd)
 }
 
-func Run(cfg config.Config) {
+// Run starts the interactive UI. images are attached to the first message.
+func Run(cfg config.Config, images []providers.Image) {
 	initialModel := model{
+		attachments: images,
 		provider:    cfg.Provider,
-		model:      cfg.Model,
-		messages:   []Message{},
-		commands:   getCommands(),
+		model:       cfg.Model,
+		maxSteps:    cfg.MaxSteps,
+		maxContinue: cfg.MaxContinuations,
+		generation:  cfg.Generation(),
+		messages:    []entry{},
+		commands:    getCommands(),
 		commandView: false,
 	}
 
 	p := tea.NewProgram(initialModel, tea.WithAltScreen())
+	program = p
 	if _, err := p.Run(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
 
+// program is the running Bubble Tea program. Work done outside Update, such as
+// the agent loop, uses it to hand messages to the UI.
+var program *tea.Program
+
 func getCommands() []Command {
 	return []Command{
 		{Name: "/provider", Description: "Switch AI provider", Action: switchProviderCmd},
 		{Name: "/model", Description: "Switch AI model", Action: switchModelCmd},
+		{Name: "/attach", Description: "Attach an image: /attach <path>", Action: attachCmd},
+		{Name: "/detach", Description: "Remove attached images", Action: detachCmd},
 		{Name: "/clear", Description: "Clear chat history", Action: clearChatCmd},
 		{Name: "/help", Description: "Show help", Action: helpCmd},
 		{Name: "/config", Description: "Configure API keys", Action: configCmd},
@@ -104,6 +152,10 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case tea.KeyMsg:
+		if m.permission != nil {
+			return m.updatePermissionPrompt(msg)
+		}
+
 		if m.commandView {
 			return m.updateCommandPalette(msg)
 		}
@@ -119,6 +171,18 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, tea.Quit
 		}
 
+		if (msg.String() == "esc" || msg.String() == "ctrl+g") && m.streaming {
+			if m.cancel != nil {
+				m.cancel()
+			}
+			return m, nil
+		}
+
+		if msg.String() == "ctrl+t" {
+			m.showThinking = !m.showThinking
+			return m, nil
+		}
+
 		if msg.String() == "enter" && !m.streaming {
 			if m.input == "" {
 				return m, nil
@@ -148,20 +212,90 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case spinnerTick:
-		m.spinnerMutex.Lock()
+		if !m.streaming {
+			return m, nil
+		}
 		m.spinnerFrame = (m.spinnerFrame + 1) % len(spinnerFrames)
-		m.spinnerMutex.Unlock()
+		return m, tickSpinner()
+
+	case streamChunk:
+		m.retry = nil
+		m.partial += msg.text
+		return m, nil
+
+	case thinkingChunk:
+		m.retry = nil
+		m.thinking += msg.text
+		return m, nil
+
+	case retryScheduled:
+		m.retry = &msg
+		return m, nil
+
+	case usageReported:
+		m.usage.Add(msg.usage)
+		m.cost += msg.cost
+		return m, nil
+
+	case replyContinued:
+		m.continued++
+		return m, nil
+
+	case budgetWarning:
+		m.warning = msg.err.Error()
+		return m, nil
+
+	case toolStarted:
+		m.flushPartial()
+		return m, nil
+
+	case toolFinished:
+		output := msg.result
+		if msg.err != nil {
+			output = "Error: " + msg.err.Error()
+		}
+		result := providers.ToolResultMessage(msg.call, output)
+		result.Content = append([]providers.ContentBlock{providers.ToolCallBlock(msg.call)}, result.Content...)
+		m.messages = append(m.messages, entry{Message: result})
+		return m, nil
+
+	case permissionRequest:
+		m.permission = &msg
 		return m, nil
 
 	case streamingComplete:
 		m.streaming = false
 		m.spinner = false
+		m.cancel = nil
+		m.retry = nil
+		m.flushPartial()
+		m.history = msg.history
+		if n := len(m.messages); n > 0 && m.messages[n-1].Role == "assistant" {
+			m.messages[n-1].Cost = msg.cost
+			m.messages[n-1].StopReason = msg.stopReason
+		}
 		return m, nil
 
 	case streamingError:
 		m.streaming = false
 		m.spinner = false
+		m.cancel = nil
+		m.retry = nil
+		m.history = msg.history
+		if errors.Is(msg.err, context.Canceled) {
+			m.messages = append(m.messages, entry{
+				Message:     streamedMessage(m.partial, m.thinking),
+				Interrupted: true,
+				Continued:   m.continued,
+			})
+			m.partial = ""
+			m.thinking = ""
+			m.continued = 0
+			return m, nil
+		}
+		m.flushPartial()
 		m.errMsg = msg.err.Error()
+		m.errHint = errorHint(msg.err, m.provider, m.model)
 		return m, nil
 	}
 
@@ -169,91 +303,248 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 func (m *model) handleCommand(input string) (tea.Model, tea.Cmd) {
+	if path, ok := strings.CutPrefix(input, "/attach "); ok {
+		return m.attachImage(strings.TrimSpace(path))
+	}
+
 	for _, cmd := range m.commands {
 		if input == cmd.Name {
 			return cmd.Action(m)
 		}
 	}
 
-	m.messages = append(m.messages, Message{
-		Role:    "assistant",
-		Content: fmt.Sprintf("Unknown command: %s", input),
-	})
+	m.messages = append(m.messages, notice(fmt.Sprintf("Unknown command: %s", input)))
 	m.input = ""
 	return m, nil
 }
 
 func (m *model) sendMessage() (tea.Model, tea.Cmd) {
-	userInput := m.input
-	m.messages = append(m.messages, Message{
-		Role:    "user",
-		Content: userInput,
-	})
+	user := providers.Message{Role: "user"}
+	for _, img := range m.attachments {
+		user.Content = append(user.Content, providers.ImageBlock(img))
+	}
+	user.Content = append(user.Content, providers.TextBlock(m.input))
+	m.attachments = nil
+	m.messages = append(m.messages, entry{Message: user})
 	m.input = ""
+	m.errMsg = ""
+	m.errHint = ""
+	m.warning = ""
 	m.streaming = true
 	m.spinner = true
 
+	history := append(append([]providers.Message{}, m.history...), user)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+
+	// The response is produced on another goroutine, which must not touch
+	// the model; it works on a copy and reports back through messages.
+	session := *m
 	return m, tea.Batch(
-		tea.Tick(time.Second/10, func(t time.Time) tea.Msg {
-			return spinnerTick{}
-		}),
+		tickSpinner(),
 		func() tea.Msg {
-			return m.streamResponse(userInput)
+			defer cancel()
+			return session.streamResponse(ctx, history)
 		},
 	)
 }
 
-func (m *model) streamResponse(userInput string) tea.Msg {
-	ctx := context.Background()
-	
-	projectContext := handlers.GetProjectContext()
-	
-	apiKey := config.GetAPIKey(m.provider)
-	if apiKey == "" {
-		return streamingError{fmt.Errorf("API key not set for provider: %s", m.provider)}
-	}
-	
-	provider := providers.NewSimpleProvider(m.provider, apiKey, m.model)
-	
-	systemPrompt := `You are Nexly, a helpful AI coding assistant. You can read, write, and edit files. 
-When asked to edit files, provide the complete updated file content. 
-Be concise and helpful. Always provide code in markdown code blocks.`
-	
-	fullPrompt := fmt.Sprintf("Project context:\n%s\n\nUser: %s", projectContext, userInput)
-	
-	messages := []providers.Message{
-		{Role: "system", Content: systemPrompt},
-		{Role: "user", Content: fullPrompt},
-	}
-
-	var response strings.Builder
-	mu := sync.Mutex{}
-
-	err := provider.SendMessage(ctx, messages, func(content string) {
-		mu.Lock()
-		response.WriteString(content)
-		mu.Unlock()
+func tickSpinner() tea.Cmd {
+	return tea.Tick(time.Second/10, func(t time.Time) tea.Msg {
+		return spinnerTick{}
 	})
+}
+
+// flushPartial moves the text and thinking streamed so far into the
+// transcript.
+func (m *model) flushPartial() {
+	if m.partial != "" || m.thinking != "" {
+		m.messages = append(m.messages, entry{
+			Message:   streamedMessage(m.partial, m.thinking),
+			Continued: m.continued,
+		})
+		m.partial = ""
+		m.thinking = ""
+	}
+	m.continued = 0
+}
+
+// streamedMessage holds the text and thinking streamed so far.
+func streamedMessage(text, thinking string) providers.Message {
+	msg := providers.Message{Role: "assistant"}
+	if thinking != "" {
+		msg.Content = append(msg.Content, providers.ThinkingBlock(thinking, ""))
+	}
+	if text != "" {
+		msg.Content = append(msg.Content, providers.TextBlock(text))
+	}
+	return msg
+}
+
+// streamResponse answers the last user message in history, sending the
+// earlier turns of the session along with it.
+func (m model) streamResponse(ctx context.Context, history []providers.Message) tea.Msg {
+	user := history[len(history)-1]
+
+	projectContext := handlers.GetProjectContext()
 
+	cfg := config.LoadConfig()
+	provider, err := cfg.NewProvider(m.provider, m.model)
 	if err != nil {
-		return streamingError{err}
+		return streamingError{err: err, history: history}
 	}
+	provider.SetGeneration(m.generation)
+	provider.SetRetry(providers.DefaultRetryPolicy, func(attempt int, wait time.Duration, err error) {
+		program.Send(retryScheduled{
+			attempt: attempt,
+			until:   time.Now().Add(wait),
+			err:     err,
+		})
+	})
+
+	systemPrompt := fmt.Sprintf(`You are Nexly, a helpful AI coding assistant. You can read, write, and edit files
+and run commands in the user's project using the tools provided.
+Use the tools to inspect and change files yourself instead of asking the user to copy code.
+Be concise and helpful. Use markdown code blocks when showing code.
+
+Project context:
+%s`, projectContext)
+
+	// Older turns are trimmed so the prompt leaves room for the reply.
+	reserve := m.generation.MaxTokens
+	if reserve <= 0 {
+		reserve = providers.DefaultMaxTokens
+	}
+	messages := providers.TrimMessages(
+		append([]providers.Message{providers.TextMessage("system", systemPrompt)}, history...),
+		providers.ContextWindow(m.model)-reserve,
+	)
 
-	result := response.String()
-	
-	config.AddMessage("user", userInput)
-	config.AddMessage("assistant", result)
+	checker := permissions.NewChecker(cfg.Permissions, askPermission, func(rule permissions.Rule) {
+		config.AddPermissionRule(rule)
+	})
+	execute := func(ctx context.Context, call providers.ToolCall) (string, error) {
+		if err := checker.Check(call); err != nil {
+			return "", err
+		}
+		return handlers.ExecuteTool(ctx, call)
+	}
 
-	m.messages = append(m.messages, Message{
-		Role:    "assistant",
-		Content: result,
+	var cost float64
+	var stopReason string
+	sessionCost := m.cost
+	warned := false
+	a := agent.New(provider, handlers.Tools(), execute, m.maxSteps)
+	a.SetMaxContinuations(m.maxContinue)
+	added, err := a.Run(ctx, messages, agent.Hooks{
+		OnEvent: func(e providers.Event) {
+			switch e.Type {
+			case providers.EventText:
+				program.Send(streamChunk{text: e.Text})
+			case providers.EventThinking:
+				program.Send(thinkingChunk{text: e.Text})
+			case providers.EventUsage:
+				c := providers.Cost(m.model, e.Usage)
+				cost += c
+				sessionCost += c
+				config.AddSpend(c)
+				program.Send(usageReported{usage: e.Usage, cost: c})
+			case providers.EventStop:
+				stopReason = e.StopReason
+			}
+		},
+		OnToolCall: func(call providers.ToolCall) {
+			program.Send(toolStarted{call: call})
+		},
+		OnToolResult: func(call providers.ToolCall, result string, err error) {
+			program.Send(toolFinished{call: call, result: result, err: err})
+		},
+		OnContinue: func() {
+			program.Send(replyContinued{})
+		},
+		BeforeRequest: func() error {
+			err := cfg.Budget.Check(sessionCost, config.LoadConfig().SpentToday())
+			if err == nil || !cfg.Budget.Warns() {
+				return err
+			}
+			if !warned {
+				warned = true
+				program.Send(budgetWarning{err: err})
+			}
+			return nil
+		},
 	})
 
-	return streamingComplete{}
+	for i, msg := range added {
+		if msg.Usage != nil {
+			added[i].Cost = providers.Cost(m.model, *msg.Usage)
+		}
+	}
+	history = append(history, added...)
+	if err != nil {
+		// A cancelled request can fail with a transport error rather than
+		// context.Canceled itself; report it as the cancellation it was.
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return streamingError{err: err, history: history}
+	}
+
+	config.AddMessages(append([]providers.Message{user}, added...)...)
+
+	return streamingComplete{history: history, cost: cost, stopReason: stopReason}
+}
+
+// toolSummary describes a tool message in the transcript: the call and the
+// first line of its result.
+func toolSummary(msg providers.Message) string {
+	var call providers.ToolCall
+	var result string
+	for _, b := range msg.Content {
+		switch b.Type {
+		case providers.BlockToolCall:
+			call = *b.ToolCall
+		case providers.BlockToolResult:
+			result = b.ToolResult.Content
+		}
+	}
+	if i := strings.Index(result, "\n"); i >= 0 {
+		result = result[:i] + " ..."
+	}
+	return fmt.Sprintf("%s %s\n%s", call.Name, call.Arguments, result)
+}
+
+// askPermission runs on the agent's goroutine and blocks until the user has
+// answered the prompt shown by the UI.
+func askPermission(call providers.ToolCall, subject string) permissions.Decision {
+	reply := make(chan permissions.Decision, 1)
+	program.Send(permissionRequest{tool: call.Name, subject: subject, reply: reply})
+	return <-reply
+}
+
+func (m *model) updatePermissionPrompt(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var decision permissions.Decision
+	switch msg.String() {
+	case "y", "enter":
+		decision = permissions.DecisionAllowOnce
+	case "a":
+		decision = permissions.DecisionAllowAlways
+	case "n", "esc":
+		decision = permissions.DecisionDeny
+	case "ctrl+c":
+		return m, tea.Quit
+	default:
+		return m, nil
+	}
+
+	m.permission.reply <- decision
+	m.permission = nil
+	return m, nil
 }
 
 func (m *model) updateCommandPalette(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	if msg.String() == "escape" {
+	if msg.String() == "esc" {
 		m.commandView = false
 		m.commandInput = ""
 		return m, nil
@@ -304,11 +595,32 @@ func (m model) View() string {
 	}
 
 	output.WriteString("\n")
-	output.WriteString(renderInput(m.input, m.streaming))
+	if m.permission != nil {
+		output.WriteString(renderPermissionPrompt(m.permission))
+	} else {
+		for _, img := range m.attachments {
+			output.WriteString(secondaryStyle.Render("Attached: "+img.Name) + "\n")
+		}
+		output.WriteString(renderInput(m.input, m.streaming))
+	}
+
+	if !m.usage.IsZero() {
+		output.WriteString("\n")
+		output.WriteString(secondaryStyle.Render(formatUsage(m.usage, m.cost)))
+	}
+
+	if m.warning != "" {
+		output.WriteString("\n")
+		output.WriteString(primaryStyle.Render("Warning: " + m.warning))
+	}
 
 	if m.errMsg != "" {
 		output.WriteString("\n")
-		output.WriteString(errorStyle.Render("Error: "+m.errMsg))
+		output.WriteString(errorStyle.Render("Error: " + m.errMsg))
+		if m.errHint != "" {
+			output.WriteString("\n")
+			output.WriteString(secondaryStyle.Render(m.errHint))
+		}
 	}
 
 	return output.String()
@@ -318,31 +630,58 @@ func (m model) renderChat() string {
 	var output strings.Builder
 
 	for _, msg := range m.messages {
-		output.WriteString(renderMessage(msg))
+		output.WriteString(renderMessage(msg, m.showThinking))
 		output.WriteString("\n")
 	}
 
 	if m.streaming {
-		m.spinnerMutex.Lock()
 		frame := spinnerFrames[m.spinnerFrame]
-		m.spinnerMutex.Unlock()
-		output.WriteString(assistantBubbleStyle.Render("Nexly") + " " + frame + "\n")
+		if m.partial != "" || m.thinking != "" {
+			output.WriteString(renderMessage(entry{Message: streamedMessage(m.partial, m.thinking)}, m.showThinking))
+		}
+		status := frame
+		if m.retry != nil {
+			status += " " + secondaryStyle.Render(m.retry.status(time.Now()))
+		}
+		output.WriteString(assistantBubbleStyle.Render("Nexly") + " " + status + "\n")
 	}
 
 	return output.String()
 }
 
-func renderMessage(msg Message) string {
+func renderMessage(msg entry, showThinking bool) string {
 	var bubble string
-	if msg.Role == "user" {
+	switch msg.Role {
+	case "user":
 		bubble = userBubbleStyle.Render("You")
-	} else {
+	case "tool":
+		bubble = toolBubbleStyle.Render("Tool")
+		return bubble + " " + secondaryStyle.Render(toolSummary(msg.Message)) + "\n"
+	default:
 		bubble = assistantBubbleStyle.Render("Nexly")
 	}
 
-	content := utils.FormatMarkdown(msg.Content)
+	content := utils.FormatMarkdown(msg.Text())
+	if thinking := msg.Thinking(); thinking != "" {
+		content = renderThinking(thinking, showThinking) + "\n" + content
+	}
+	for _, img := range msg.Images() {
+		content = strings.TrimRight(content, "\n") + "\n" + secondaryStyle.Render("[image: "+img.Name+"]")
+	}
+	if msg.Interrupted {
+		content = strings.TrimRight(content, "\n") + "\n" + secondaryStyle.Render("[interrupted]")
+	}
+	if msg.Continued > 0 {
+		content = strings.TrimRight(content, "\n") + "\n" + secondaryStyle.Render(continuedNote(msg.Continued))
+	}
+	if note := stopNote(msg.StopReason); note != "" {
+		content = strings.TrimRight(content, "\n") + "\n" + secondaryStyle.Render(note)
+	}
+	if msg.Cost > 0 {
+		content = strings.TrimRight(content, "\n") + "\n" + secondaryStyle.Render(formatCost(msg.Cost))
+	}
 	lines := strings.Split(content, "\n")
-	
+
 	var contentStr strings.Builder
 	for i, line := range lines {
 		if i > 0 {
@@ -354,6 +693,22 @@ func renderMessage(msg Message) string {
 	return bubble + "\n" + contentStr.String()
 }
 
+// renderThinking shows the model's reasoning dimmed, collapsed to a single
+// line unless expanded with Ctrl+T.
+func renderThinking(thinking string, expanded bool) string {
+	lines := strings.Split(strings.TrimSpace(thinking), "\n")
+	if !expanded {
+		return secondaryStyle.Render(fmt.Sprintf("▸ Thinking (%d lines, Ctrl+T to expand)", len(lines)))
+	}
+
+	var out strings.Builder
+	out.WriteString(secondaryStyle.Render("▾ Thinking (Ctrl+T to collapse)"))
+	for _, line := range lines {
+		out.WriteString("\n" + thinkingStyle.Render("│ "+line))
+	}
+	return out.String()
+}
+
 func renderInput(input string, disabled bool) string {
 	prompt := primaryStyle.Render("> ")
 	if disabled {
@@ -362,6 +717,75 @@ func renderInput(input string, disabled bool) string {
 	return prompt + input + "_"
 }
 
+// stopNote explains a reply that ended before the model finished it, or
+// returns "" for one that ended normally.
+func stopNote(reason string) string {
+	switch reason {
+	case "", providers.StopEnd, providers.StopToolUse:
+		return ""
+	case providers.StopMaxTokens:
+		return "[stopped: reached the max tokens limit]"
+	case providers.StopSequence:
+		return "[stopped at a stop sequence]"
+	}
+	return "[stopped: " + reason + "]"
+}
+
+func continuedNote(n int) string {
+	if n == 1 {
+		return "[continued after reaching the max tokens limit]"
+	}
+	return fmt.Sprintf("[continued %d times after reaching the max tokens limit]", n)
+}
+
+// errorHint suggests what to do about a failed request, or returns "" if
+// there is nothing specific to suggest.
+func errorHint(err error, provider, model string) string {
+	switch {
+	case errors.Is(err, providers.ErrNoAPIKey), errors.Is(err, providers.ErrAuth):
+		return fmt.Sprintf("Run /config to see how to set your %s key.", provider)
+	case errors.Is(err, providers.ErrRateLimit):
+		return fmt.Sprintf("%s is rate limiting requests: wait a moment, or switch model with /model.", provider)
+	case errors.Is(err, providers.ErrQuota):
+		return fmt.Sprintf("Your %s account is out of credit or over its quota: check its billing settings, or switch provider with /provider.", provider)
+	case errors.Is(err, providers.ErrContextLength):
+		return fmt.Sprintf("The conversation is too long for %s: start over with /clear, or switch to a model with a larger context window.", model)
+	case errors.Is(err, providers.ErrModelNotFound):
+		return fmt.Sprintf("%s does not serve %s: pick another model with /model, or run 'nexly models refresh'.", provider, model)
+	case errors.Is(err, providers.ErrContentFiltered):
+		return "The provider's content filter blocked this: rephrase the request."
+	case errors.Is(err, providers.ErrOverloaded):
+		return fmt.Sprintf("%s is overloaded: try again shortly, or switch provider with /provider.", provider)
+	case errors.Is(err, config.ErrBudgetExceeded):
+		return "Raise the budget in ~/.nexly/config.json, or set its mode to \"warn\"."
+	}
+	return ""
+}
+
+// formatUsage summarizes the tokens used in the session and their cost.
+func formatUsage(u providers.Usage, cost float64) string {
+	text := fmt.Sprintf("Tokens: %d in, %d out", u.InputTokens, u.OutputTokens)
+	if u.CachedTokens > 0 {
+		text += fmt.Sprintf(" (%d cached)", u.CachedTokens)
+	}
+	if cost > 0 {
+		text += " · " + formatCost(cost)
+	}
+	return text
+}
+
+func formatCost(cost float64) string {
+	if cost < 0.01 {
+		return fmt.Sprintf("$%.4f", cost)
+	}
+	return fmt.Sprintf("$%.2f", cost)
+}
+
+func renderPermissionPrompt(req *permissionRequest) string {
+	return primaryStyle.Render("Allow "+req.tool) + " " + req.subject + "\n" +
+		secondaryStyle.Render("[y] yes  [n] no  [a] always allow")
+}
+
 func (m model) renderCommandPalette() string {
 	var output strings.Builder
 
@@ -395,47 +819,139 @@ func (m model) renderCommandPalette() string {
 
 type spinnerTick struct{}
 
-type streamingComplete struct{}
+// permissionRequest asks the user whether a tool call may run. The answer is
+// sent back on reply.
+type permissionRequest struct {
+	tool    string
+	subject string
+	reply   chan permissions.Decision
+}
+
+// streamChunk carries a piece of the reply as it arrives.
+type streamChunk struct {
+	text string
+}
 
-type streamingError struct {
+type toolStarted struct {
+	call providers.ToolCall
+}
+
+type toolFinished struct {
+	call   providers.ToolCall
+	result string
+	err    error
+}
+
+// retryScheduled reports that a request failed and will be sent again once
+// until has passed.
+type retryScheduled struct {
+	attempt int
+	until   time.Time
+	err     error
+}
+
+func (r retryScheduled) status(now time.Time) string {
+	remaining := r.until.Sub(now).Round(time.Second)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return fmt.Sprintf("Retrying in %s (attempt %d of %d): %s",
+		remaining, r.attempt+1, providers.DefaultRetryPolicy.MaxAttempts, utils.Truncate(r.err.Error(), 60))
+}
+
+type usageReported struct {
+	usage providers.Usage
+	cost  float64
+}
+
+type thinkingChunk struct {
+	text string
+}
+
+type replyContinued struct{}
+
+type budgetWarning struct {
 	err error
 }
 
+type streamingComplete struct {
+	history    []providers.Message
+	cost       float64
+	stopReason string
+}
+
+type streamingError struct {
+	err     error
+	history []providers.Message
+}
+
 var spinnerFrames = []string{
 	"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏",
 }
 
 func switchProviderCmd(m *model) (tea.Model, tea.Cmd) {
 	providersList := config.GetProviders()
-	m.messages = append(m.messages, Message{
-		Role:    "assistant",
-		Content: "Available providers:\n" + strings.Join(providersList, "\n") + "\n\nUse 'nexly provider set <provider>' to switch.",
-	})
+	m.messages = append(m.messages, notice("Available providers:\n"+strings.Join(providersList, "\n")+"\n\nUse 'nexly provider set <provider>' to switch."))
 	m.commandView = false
 	m.commandInput = ""
 	return m, nil
 }
 
 func switchModelCmd(m *model) (tea.Model, tea.Cmd) {
-	models := config.GetModels(m.provider)
-	m.messages = append(m.messages, Message{
-		Role:    "assistant",
-		Content: fmt.Sprintf("Available models for %s:\n%s\n\nUse 'nexly model set <model>' to switch.", m.provider, strings.Join(models, "\n")),
-	})
+	var models []string
+	for _, name := range config.GetModels(m.provider) {
+		info, _ := providers.LookupModel(name)
+		models = append(models, fmt.Sprintf("%s - %s", name, info.Summary()))
+	}
+	m.messages = append(m.messages, notice(fmt.Sprintf("Available models for %s:\n%s\n\nUse 'nexly model set <model>' to switch.", m.provider, strings.Join(models, "\n"))))
 	m.commandView = false
 	m.commandInput = ""
 	return m, nil
 }
 
+func attachCmd(m *model) (tea.Model, tea.Cmd) {
+	m.commandView = false
+	m.commandInput = ""
+	m.input = "/attach "
+	return m, nil
+}
+
+// attachImage adds an image to the next message, if the model can see it.
+func (m *model) attachImage(path string) (tea.Model, tea.Cmd) {
+	m.input = ""
+	m.errMsg = ""
+	m.errHint = ""
+	if err := providers.CheckVision(m.model); err != nil {
+		m.errMsg = err.Error()
+		m.errHint = "Switch to a vision model with /model to attach images."
+		return m, nil
+	}
+	img, err := providers.LoadImage(path)
+	if err != nil {
+		m.errMsg = err.Error()
+		return m, nil
+	}
+	m.attachments = append(m.attachments, img)
+	return m, nil
+}
+
+func detachCmd(m *model) (tea.Model, tea.Cmd) {
+	m.commandView = false
+	m.commandInput = ""
+	m.input = ""
+	m.attachments = nil
+	return m, nil
+}
+
 func clearChatCmd(m *model) (tea.Model, tea.Cmd) {
 	config.ClearHistory()
-	m.messages = []Message{}
+	m.messages = []entry{}
+	m.history = nil
+	m.usage = providers.Usage{}
+	m.cost = 0
 	m.commandView = false
 	m.commandInput = ""
-	m.messages = append(m.messages, Message{
-		Role:    "assistant",
-		Content: "Chat history cleared.",
-	})
+	m.messages = append(m.messages, notice("Chat history cleared."))
 	return m, nil
 }
 
@@ -449,6 +965,8 @@ Nexly - AI Coding Assistant
 Commands:
   /provider    - Switch AI provider
   /model      - Switch AI model
+  /attach     - Attach an image: /attach <path>
+  /detach     - Remove attached images
   /clear      - Clear chat history
   /config     - Configure API keys
   /help       - Show this help
@@ -458,11 +976,15 @@ Keyboard Shortcuts:
   Ctrl+P      - Open command palette
   Ctrl+C      - Exit Nexly
   Ctrl+U      - Clear input
+  Esc/Ctrl+G  - Stop the current response
+  Ctrl+T      - Show or hide the model's thinking
+
+Permission prompts:
+  y / Enter   - Allow this once
+  a           - Always allow (saved to config)
+  n / Esc     - Deny
 `
-	m.messages = append(m.messages, Message{
-		Role:    "assistant",
-		Content: helpText,
-	})
+	m.messages = append(m.messages, notice(helpText))
 	return m, nil
 }
 
@@ -484,15 +1006,17 @@ To set API keys, edit ~/.nexly/config.json:
     "google": "AIza...",
     "openrouter": "sk-or-...",
     "nvidia": "nvapi-..."
+  },
+  "custom_providers": {
+    "ollama": {
+      "base_url": "http://localhost:11434/v1",
+      "models": ["llama3.1", "qwen2.5-coder"]
+    }
   }
 }
 
-Available providers: openai, anthropic, google, openrouter, nvidia
-`
-	m.messages = append(m.messages, Message{
-		Role:    "assistant",
-		Content: configText,
-	})
+Available providers: ` + strings.Join(config.GetProviders(), ", ") + "\n"
+	m.messages = append(m.messages, notice(configText))
 	return m, nil
 }
 